@@ -0,0 +1,262 @@
+package zone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"sync"
+)
+
+// Cache maintains the records of a set of forward and reverse zones, and the devices
+// they describe. On each refresh the zone SOA serial numbers are checked, unchanged zones
+// are skipped, and changed zones are updated via an incremental transfer (IXFR), falling back
+// to a full transfer (AXFR) if the server is unable to provide the differences.
+type Cache struct {
+	Service *Service
+	Zones   []string
+	Reverse []string
+
+	mu      sync.RWMutex
+	records map[string]*cacheZone
+	dirty   bool // records have changed since the devices were built
+	index   *IndexedDevices
+}
+
+// the current records of a single zone
+type cacheZone struct {
+	serial uint32
+	rr     []dns.RR
+}
+
+func NewCache(service *Service, zones, reverse []string) *Cache {
+	return &Cache{
+		Service: service,
+		Zones:   zones,
+		Reverse: reverse,
+	}
+}
+
+// Serial queries the current SOA serial number of a zone.
+func (s *Service) Serial(zone string) (uint32, error) {
+	return s.SerialContext(context.Background(), zone)
+}
+
+func (s *Service) SerialContext(ctx context.Context, zone string) (uint32, error) {
+	soa, err := s.SOAContext(ctx, zone)
+	if err != nil {
+		return 0, err
+	}
+	return soa.Serial, nil
+}
+
+// SOA queries the current SOA record of a zone.
+func (s *Service) SOA(zone string) (*dns.SOA, error) {
+	return s.SOAContext(context.Background(), zone)
+}
+
+func (s *Service) SOAContext(ctx context.Context, zone string) (*dns.SOA, error) {
+	ans, err := s.LookupContext(ctx, zone, dns.TypeSOA)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range ans {
+		if soa, ok := r.(*dns.SOA); ok {
+			return soa, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("no soa record found for %s", zone))
+}
+
+// TransferIncremental requests the changes to a zone since the given serial number (IXFR),
+// the server may respond with the full zone instead.
+func (s *Service) TransferIncremental(zone string, serial uint32) ([]dns.RR, error) {
+	return s.TransferIncrementalContext(context.Background(), zone, serial)
+}
+
+func (s *Service) TransferIncrementalContext(ctx context.Context, zone string, serial uint32) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetIxfr(dns.Fqdn(zone), serial, ".", ".")
+
+	return s.transfer(ctx, m)
+}
+
+// a key used to match records ignoring their ttl
+func recordKey(rr dns.RR) string {
+	r := dns.Copy(rr)
+	r.Header().Ttl = 0
+	return r.String()
+}
+
+// apply an IXFR response to the current zone records at the given serial, as per RFC 1995 the
+// response is either a single SOA (no changes), a full zone transfer, or a sequence of deletions
+// and additions each starting with an SOA record.
+func applyIncremental(current []dns.RR, serial uint32, rr []dns.RR) ([]dns.RR, uint32, error) {
+	if !(len(rr) > 0) {
+		return nil, 0, errors.New("empty incremental transfer")
+	}
+	soa, ok := rr[0].(*dns.SOA)
+	if !ok {
+		return nil, 0, errors.New("incremental transfer does not start with an soa record")
+	}
+
+	// no changes, unless the server only reports a different serial
+	if len(rr) == 1 {
+		if soa.Serial != serial {
+			return nil, 0, errors.New(fmt.Sprintf("incremental transfer has no changes for serial %d, expected %d", soa.Serial, serial))
+		}
+		return current, soa.Serial, nil
+	}
+
+	// full zone transfer
+	if _, ok := rr[1].(*dns.SOA); !ok {
+		if _, ok := rr[len(rr)-1].(*dns.SOA); ok {
+			rr = rr[:len(rr)-1]
+		}
+		return rr, soa.Serial, nil
+	}
+
+	keys := make(map[string]int)
+	records := make([]dns.RR, 0, len(current))
+	for _, r := range current {
+		if _, ok := r.(*dns.SOA); ok {
+			continue
+		}
+		keys[recordKey(r)] = len(records)
+		records = append(records, r)
+	}
+
+	// each sequence starts with the old soa, deletions, the new soa, then additions
+	adding := true
+	for _, r := range rr[1 : len(rr)-1] {
+		if _, ok := r.(*dns.SOA); ok {
+			adding = !adding
+			continue
+		}
+		k := recordKey(r)
+		switch i, ok := keys[k]; {
+		case adding && ok:
+			records[i] = r
+		case adding:
+			keys[k] = len(records)
+			records = append(records, r)
+		case ok:
+			records[i] = nil
+			delete(keys, k)
+		}
+	}
+
+	res := []dns.RR{soa}
+	for _, r := range records {
+		if r != nil {
+			res = append(res, r)
+		}
+	}
+
+	return res, soa.Serial, nil
+}
+
+// refresh the records of a single zone, marking the cache dirty if they have changed
+func (c *Cache) refreshZone(ctx context.Context, zone string) error {
+	serial, err := c.Service.SerialContext(ctx, zone)
+	if err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	z, ok := c.records[zone]
+	c.mu.RUnlock()
+
+	if ok && z.serial == serial {
+		return nil
+	}
+
+	var res *cacheZone
+	if ok {
+		if rr, err := c.Service.TransferIncrementalContext(ctx, zone, z.serial); err == nil {
+			if r, s, err := applyIncremental(z.rr, z.serial, rr); err == nil {
+				res = &cacheZone{serial: s, rr: r}
+			}
+		}
+	}
+	if res == nil {
+		rr, err := c.Service.TransferContext(ctx, zone)
+		if err != nil {
+			return err
+		}
+		res = &cacheZone{serial: serial, rr: rr}
+	}
+
+	c.mu.Lock()
+	if c.records == nil {
+		c.records = make(map[string]*cacheZone)
+	}
+	c.records[zone] = res
+	c.dirty = true
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Refresh brings the cached zones up to date, rebuilding the devices if any have changed.
+func (c *Cache) Refresh() (bool, error) {
+	return c.RefreshContext(context.Background())
+}
+
+func (c *Cache) RefreshContext(ctx context.Context) (bool, error) {
+
+	// zones refreshed before a failure stay dirty until the devices are rebuilt
+	for _, z := range append(append([]string{}, c.Reverse...), c.Zones...) {
+		if err := c.refreshZone(ctx, z); err != nil {
+			return false, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty && c.index != nil {
+		return false, nil
+	}
+
+	var rr, ptrs []dns.RR
+	for _, z := range c.Reverse {
+		ptrs = append(ptrs, c.records[z].rr...)
+	}
+	for _, z := range c.Zones {
+		rr = append(rr, c.records[z].rr...)
+	}
+
+	c.index = NewIndexedDevices(&Devices{List: assemble(rr, ptrs)})
+	c.dirty = false
+
+	return true, nil
+}
+
+// Index returns the current indexed snapshot of cached devices, rebuilt on each change.
+func (c *Cache) Index() *IndexedDevices {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.index == nil {
+		return NewIndexedDevices(&Devices{})
+	}
+	return c.index
+}
+
+// Devices returns the current snapshot of cached devices.
+func (c *Cache) Devices() *Devices {
+	return c.Index().Devices()
+}
+
+// Load refreshes the cache and returns the current devices.
+func (c *Cache) Load() (*Devices, error) {
+	return c.LoadContext(context.Background())
+}
+
+func (c *Cache) LoadContext(ctx context.Context) (*Devices, error) {
+	if _, err := c.RefreshContext(ctx); err != nil {
+		return nil, err
+	}
+	return c.Devices(), nil
+}
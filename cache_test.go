@@ -0,0 +1,134 @@
+package zone
+
+import (
+	"github.com/miekg/dns"
+	"testing"
+)
+
+func TestApplyIncremental(t *testing.T) {
+
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	current := []dns.RR{
+		rr("example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. 1 3600 900 604800 300"),
+		rr("a.example.com. 3600 IN A 10.0.0.1"),
+		rr("b.example.com. 3600 IN A 10.0.0.2"),
+	}
+
+	res, serial, err := applyIncremental(current, 1, []dns.RR{
+		rr("example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. 3 3600 900 604800 300"),
+		rr("example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. 1 3600 900 604800 300"),
+		rr("b.example.com. 3600 IN A 10.0.0.2"),
+		rr("example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. 2 3600 900 604800 300"),
+		rr("c.example.com. 3600 IN A 10.0.0.3"),
+		rr("example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. 2 3600 900 604800 300"),
+		rr("a.example.com. 3600 IN A 10.0.0.1"),
+		rr("example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. 3 3600 900 604800 300"),
+		rr("d.example.com. 3600 IN A 10.0.0.4"),
+		rr("example.com. 3600 IN SOA ns.example.com. hostmaster.example.com. 3 3600 900 604800 300"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial != 3 {
+		t.Errorf("applyIncremental: serial %d", serial)
+	}
+
+	var names []string
+	for _, r := range res {
+		names = append(names, r.Header().Name)
+	}
+	if len(names) != 3 || names[1] != "c.example.com." || names[2] != "d.example.com." {
+		t.Errorf("applyIncremental: %v", names)
+	}
+}
+
+func TestApplyIncrementalSOA(t *testing.T) {
+
+	current := []dns.RR{
+		&dns.SOA{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET}, Serial: 2},
+	}
+
+	// a single soa is only an unchanged zone if the serial matches
+	if res, serial, err := applyIncremental(current, 2, current); err != nil || serial != 2 || len(res) != 1 {
+		t.Errorf("applyIncremental: unchanged %v %d %v", res, serial, err)
+	}
+	if _, _, err := applyIncremental(current, 1, current); err == nil {
+		t.Error("applyIncremental: expected an error for a serial mismatch")
+	}
+}
+
+func TestCache(t *testing.T) {
+	srv, s := testService(t)
+
+	cache := NewCache(s, []string{"example.com."}, []string{"10.in-addr.arpa."})
+
+	place := func() string {
+		d := cache.Index().Find("wel-gw.example.com.")
+		if d == nil {
+			return ""
+		}
+		return d.Place
+	}
+
+	if ok, err := cache.Refresh(); err != nil || !ok {
+		t.Fatalf("Refresh: initial %v %v", ok, err)
+	}
+	if p := place(); p != "Wellington Office" {
+		t.Errorf("Refresh: initial place %q", p)
+	}
+	if ok, err := cache.Refresh(); err != nil || ok {
+		t.Errorf("Refresh: unchanged %v %v", ok, err)
+	}
+
+	update := func(p string) {
+		d, err := s.Find("wel-gw.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Place = p
+		if err := s.ReplaceInfo("example.com.", d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	serial := srv.Serial("example.com.")
+	update("Wellington")
+
+	// the server provides the differences since the cached serial
+	rr, err := s.TransferIncremental("example.com.", serial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, ok := rr[1].(*dns.SOA); len(rr) < 4 || !ok || x.Serial != serial {
+		t.Fatalf("TransferIncremental: expected an incremental response, found %v", rr)
+	}
+
+	if ok, err := cache.Refresh(); err != nil || !ok {
+		t.Errorf("Refresh: incremental %v %v", ok, err)
+	}
+	if p := place(); p != "Wellington" {
+		t.Errorf("Refresh: incremental place %q", p)
+	}
+
+	// a later zone failure must not lose the changes already transferred
+	update("Wellington City")
+	zones := cache.Zones
+	cache.Zones = append(append([]string{}, zones...), "missing.example.org.")
+	if _, err := cache.Refresh(); err == nil {
+		t.Fatal("Refresh: expected a missing zone error")
+	}
+	cache.Zones = zones
+	if ok, err := cache.Refresh(); err != nil || !ok {
+		t.Errorf("Refresh: after failure %v %v", ok, err)
+	}
+	if p := place(); p != "Wellington City" {
+		t.Errorf("Refresh: after failure place %q", p)
+	}
+}
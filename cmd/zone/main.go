@@ -0,0 +1,453 @@
+// zone queries and edits the equipment details stored in DNS.
+//
+// Usage:
+//
+//	zone [flags] <command> [args]
+//
+// Commands:
+//
+//	list                      list all devices
+//	find <name>               find a device by name
+//	find-ip <address>         find a device by address
+//	by-model <model>          list devices with the given model
+//	by-code <code>            list devices with the given code
+//	by-place <place>          list devices at the given place
+//	by-network <cidr>         list devices within the given network
+//	query <expression>        list devices matching a query, e.g. 'model~"Q330.*" and code=WEL'
+//	summary                   count the devices per model, code and place, and any missing details
+//	update-info <name>        update the place, model, code and location of a device
+//	update <file>             update aliases, reverse and mapping entries from a json device file
+//	remove <name>             remove all records of a device
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/miekg/dns"
+	zone "github.com/ozym/place"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type settings struct {
+	server  string
+	port    string
+	zone    string
+	zones   string
+	reverse string
+	key     string
+	ttl     uint
+	timeout time.Duration
+	json    bool
+	dryRun  bool
+	verbose bool
+
+	place  string
+	model  string
+	code   string
+	lat    float64
+	lon    float64
+	height float64
+
+	// the flags given on the command line
+	set map[string]bool
+}
+
+func split(s string) []string {
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, fqdn(v))
+		}
+	}
+	return res
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func (s *settings) service() (*zone.Service, error) {
+	svc := zone.NewService(s.server)
+	if s.key != "" {
+		k, err := zone.ReadKeyFile(s.key)
+		if err != nil {
+			return nil, err
+		}
+		svc = zone.NewServiceWithKey(s.server, k)
+	}
+	if s.port != "" {
+		svc.Port = s.port
+	}
+	if s.dryRun {
+		svc.DryRun = &zone.Plan{}
+	}
+	if s.verbose {
+		svc.Logger = zone.NewSlogLogger(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	}
+	return svc, nil
+}
+
+// the devices of the forward and reverse zones, indexed for lookups
+func (s *settings) list(ctx context.Context) (*zone.IndexedDevices, error) {
+	svc, err := s.service()
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := svc.ListContext(ctx, split(s.zones), split(s.reverse))
+	if err != nil {
+		return nil, err
+	}
+
+	return zone.NewIndexedDevices(&zone.Devices{List: l}), nil
+}
+
+func (s *settings) output(devices []*zone.Device) error {
+	if s.json {
+		if devices == nil {
+			devices = []*zone.Device{}
+		}
+		b, err := json.MarshalIndent(devices, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tIP\tIP6\tMODEL\tCODE\tPLACE\tLATITUDE\tLONGITUDE\tHEIGHT")
+	for _, d := range devices {
+		var ip, ip6 string
+		if d.IP != nil {
+			ip = d.IP.String()
+		}
+		if d.IP6 != nil {
+			ip6 = d.IP6.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%.6f\t%.6f\t%.1f\n",
+			d.Name, ip, ip6, d.Model, d.Code, d.Place, d.Latitude, d.Longitude, d.Height)
+	}
+	return w.Flush()
+}
+
+func (s *settings) summary(sum *zone.Summary) error {
+	if s.json {
+		b, err := json.MarshalIndent(sum, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	counts := func(w io.Writer, kind string, m map[string]int) {
+		var keys []string
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", kind, k, m[k])
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "devices\t\t%d\n", sum.Devices)
+	counts(w, "model", sum.Models)
+	counts(w, "code", sum.Codes)
+	counts(w, "place", sum.Places)
+	fmt.Fprintf(w, "missing\tLOC\t%d\n", sum.MissingLOC)
+	fmt.Fprintf(w, "missing\tHINFO\t%d\n", sum.MissingHINFO)
+	fmt.Fprintf(w, "missing\tTXT\t%d\n", sum.MissingTXT)
+	for _, p := range sum.Unlocated {
+		fmt.Fprintf(w, "unlocated\t%s\t\n", p)
+	}
+	fmt.Fprintf(w, "aliases\t\t%d\n", sum.Aliases)
+	fmt.Fprintf(w, "mappings\t\t%d\n", sum.Mappings)
+	return w.Flush()
+}
+
+// output any planned updates of a dry run
+func (s *settings) plan(svc *zone.Service) error {
+	if svc.DryRun == nil {
+		return nil
+	}
+	_, err := fmt.Print(svc.DryRun.String())
+	return err
+}
+
+func (s *settings) run(ctx context.Context, cmd string, args []string) error {
+	need := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("%s: expected %d argument(s)", cmd, n)
+		}
+		return nil
+	}
+
+	switch cmd {
+	case "list":
+		x, err := s.list(ctx)
+		if err != nil {
+			return err
+		}
+		return s.output(x.Devices().List)
+	case "find":
+		if err := need(1); err != nil {
+			return err
+		}
+		svc, err := s.service()
+		if err != nil {
+			return err
+		}
+		d, err := svc.FindContext(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			return fmt.Errorf("unable to find device %s", args[0])
+		}
+		return s.output([]*zone.Device{d})
+	case "find-ip":
+		if err := need(1); err != nil {
+			return err
+		}
+		ip := net.ParseIP(args[0])
+		if ip == nil {
+			return fmt.Errorf("invalid address %s", args[0])
+		}
+		svc, err := s.service()
+		if err != nil {
+			return err
+		}
+		d, err := svc.FindByIPContext(ctx, ip)
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			return fmt.Errorf("unable to find device for %s", args[0])
+		}
+		return s.output([]*zone.Device{d})
+	case "by-model", "by-code", "by-place", "by-network":
+		if err := need(1); err != nil {
+			return err
+		}
+		x, err := s.list(ctx)
+		if err != nil {
+			return err
+		}
+		var d *zone.Devices
+		switch cmd {
+		case "by-model":
+			d = x.ListByModel(args[0])
+		case "by-code":
+			d = x.ListByCode(args[0])
+		case "by-place":
+			d = x.ListByPlace(args[0])
+		case "by-network":
+			_, n, err := net.ParseCIDR(args[0])
+			if err != nil {
+				return err
+			}
+			d = x.ListByNetwork(*n)
+		}
+		return s.output(d.List)
+	case "query":
+		if err := need(1); err != nil {
+			return err
+		}
+		x, err := s.list(ctx)
+		if err != nil {
+			return err
+		}
+		m, err := x.Devices().Query(args[0])
+		if err != nil {
+			return err
+		}
+		return s.output(m.List)
+	case "summary":
+		x, err := s.list(ctx)
+		if err != nil {
+			return err
+		}
+		return s.summary(x.Devices().Summary())
+	case "update-info":
+		if err := need(1); err != nil {
+			return err
+		}
+		if s.zone == "" {
+			return fmt.Errorf("%s: no zone given", cmd)
+		}
+		svc, err := s.service()
+		if err != nil {
+			return err
+		}
+		// the zone must not change between finding and updating
+		soa, err := svc.SOAContext(ctx, fqdn(s.zone))
+		if err != nil {
+			return err
+		}
+		// only the given flags replace the current details
+		d, err := svc.FindContext(ctx, fqdn(args[0]))
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			return fmt.Errorf("unable to find device %s", args[0])
+		}
+		// details cleared by a flag have their records removed
+		var types []uint16
+		if s.set["place"] {
+			d.Place = s.place
+			types = append(types, dns.TypeTXT)
+		}
+		if s.set["model"] {
+			d.Model = s.model
+			types = append(types, dns.TypeHINFO)
+		}
+		if s.set["code"] {
+			d.Code = s.code
+			types = append(types, dns.TypeHINFO)
+		}
+		if s.set["latitude"] {
+			d.Latitude = s.lat
+			types = append(types, dns.TypeLOC)
+		}
+		if s.set["longitude"] {
+			d.Longitude = s.lon
+			types = append(types, dns.TypeLOC)
+		}
+		if s.set["height"] {
+			d.Height = s.height
+			types = append(types, dns.TypeLOC)
+		}
+		p := zone.Plan{}
+		p.SerialUnchanged(soa)
+		svc.PlanReplaceInfo(&p, fqdn(s.zone), d, types...)
+		if err := svc.SendContext(ctx, &p); err != nil {
+			return err
+		}
+		return s.plan(svc)
+	case "update":
+		if err := need(1); err != nil {
+			return err
+		}
+		if s.zone == "" {
+			return fmt.Errorf("%s: no zone given", cmd)
+		}
+		b, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		var to zone.Device
+		if err := json.Unmarshal(b, &to); err != nil {
+			return err
+		}
+		svc, err := s.service()
+		if err != nil {
+			return err
+		}
+		// the zone must not change between listing and updating
+		soa, err := svc.SOAContext(ctx, fqdn(s.zone))
+		if err != nil {
+			return err
+		}
+		x, err := s.list(ctx)
+		if err != nil {
+			return err
+		}
+		from := x.Find(fqdn(to.Name))
+		if from == nil {
+			return fmt.Errorf("unable to find device %s", to.Name)
+		}
+		p := zone.Plan{}
+		p.SerialUnchanged(soa)
+		if err := svc.PlanUpdateContext(ctx, &p, fqdn(s.zone), uint32(s.ttl), from, &to); err != nil {
+			return err
+		}
+		if err := svc.SendContext(ctx, &p); err != nil {
+			return err
+		}
+		return s.plan(svc)
+	case "remove":
+		if err := need(1); err != nil {
+			return err
+		}
+		if s.zone == "" {
+			return fmt.Errorf("%s: no zone given", cmd)
+		}
+		svc, err := s.service()
+		if err != nil {
+			return err
+		}
+		if err := svc.RemoveAllContext(ctx, fqdn(s.zone), &zone.Device{Name: fqdn(args[0])}); err != nil {
+			return err
+		}
+		return s.plan(svc)
+	default:
+		return fmt.Errorf("unknown command %s", cmd)
+	}
+}
+
+func main() {
+	var s settings
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <command> [args]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Commands: list, find, find-ip, by-model, by-code, by-place, by-network, query, summary, update-info, update, remove\n\n")
+		flag.PrintDefaults()
+	}
+
+	flag.StringVar(&s.server, "server", "localhost", "dns server")
+	flag.StringVar(&s.port, "port", "", "dns server port")
+	flag.StringVar(&s.zone, "zone", "", "zone to update")
+	flag.StringVar(&s.zones, "zones", "", "comma separated list of forward zones to list")
+	flag.StringVar(&s.reverse, "reverse", "", "comma separated list of reverse zones to list")
+	flag.StringVar(&s.key, "key", "", "BIND style tsig key file")
+	flag.UintVar(&s.ttl, "ttl", 3600, "record ttl for updates")
+	flag.DurationVar(&s.timeout, "timeout", time.Minute, "overall time limit for dns requests")
+	flag.BoolVar(&s.json, "json", false, "output json rather than a table")
+	flag.BoolVar(&s.dryRun, "dry-run", false, "print the planned updates rather than sending them")
+	flag.BoolVar(&s.verbose, "verbose", false, "log update changes to stderr")
+
+	flag.StringVar(&s.place, "place", "", "device place name (update-info)")
+	flag.StringVar(&s.model, "model", "", "device model (update-info)")
+	flag.StringVar(&s.code, "code", "", "device site code (update-info)")
+	flag.Float64Var(&s.lat, "latitude", 0.0, "device latitude (update-info)")
+	flag.Float64Var(&s.lon, "longitude", 0.0, "device longitude (update-info)")
+	flag.Float64Var(&s.height, "height", 0.0, "device height (update-info)")
+
+	flag.Parse()
+
+	s.set = make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		s.set[f.Name] = true
+	})
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	err := s.run(ctx, flag.Arg(0), flag.Args()[1:])
+	cancel()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
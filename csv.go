@@ -0,0 +1,236 @@
+package zone
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The CSV column layout, a header row is always written and is required when reading, which
+// allows the columns to be reordered or omitted (except for name). List columns (reverse and
+// aliases) are space separated, mapping entries are space separated name=ip pairs.
+var CSVColumns = []string{
+	"name",
+	"ip",
+	"ip6",
+	"reverse",
+	"aliases",
+	"mapping",
+	"place",
+	"model",
+	"code",
+	"latitude",
+	"longitude",
+	"height",
+}
+
+func csvIP(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+func csvFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// encode the CSV value of a device column
+func csvValue(d *Device, column string) string {
+	switch column {
+	case "name":
+		return d.Name
+	case "ip":
+		return csvIP(d.IP)
+	case "ip6":
+		return csvIP(d.IP6)
+	case "reverse":
+		var l []string
+		for _, r := range d.Reverse {
+			l = append(l, r.String())
+		}
+		return strings.Join(l, " ")
+	case "aliases":
+		return strings.Join(d.Aliases, " ")
+	case "mapping":
+		var l []string
+		for n, ip := range d.Mapping {
+			l = append(l, n+"="+ip.String())
+		}
+		sort.Strings(l)
+		return strings.Join(l, " ")
+	case "place":
+		return d.Place
+	case "model":
+		return d.Model
+	case "code":
+		return d.Code
+	case "latitude":
+		return csvFloat(d.Latitude)
+	case "longitude":
+		return csvFloat(d.Longitude)
+	case "height":
+		return csvFloat(d.Height)
+	}
+	return ""
+}
+
+// decode the CSV value of a device column
+func csvDecode(d *Device, column, value string) error {
+	value = strings.TrimSpace(value)
+
+	parseIP := func(v string) (net.IP, error) {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return nil, errors.New(fmt.Sprintf("invalid %s address %s for %s", column, v, d.Name))
+		}
+		return ip, nil
+	}
+	parseFloat := func(v string) (float64, error) {
+		if v == "" {
+			return 0.0, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0.0, errors.New(fmt.Sprintf("invalid %s %s for %s", column, v, d.Name))
+		}
+		return f, nil
+	}
+
+	var err error
+	switch column {
+	case "name":
+		d.Name = value
+	case "ip", "ip6":
+		if value == "" {
+			return nil
+		}
+		ip, err := parseIP(value)
+		if err != nil {
+			return err
+		}
+		if column == "ip" {
+			d.IP = ip
+		} else {
+			d.IP6 = ip
+		}
+	case "reverse":
+		for _, v := range strings.Fields(value) {
+			ip, err := parseIP(v)
+			if err != nil {
+				return err
+			}
+			d.Reverse = append(d.Reverse, ip)
+		}
+	case "aliases":
+		d.Aliases = strings.Fields(value)
+	case "mapping":
+		for _, v := range strings.Fields(value) {
+			p := strings.SplitN(v, "=", 2)
+			if len(p) != 2 {
+				return errors.New(fmt.Sprintf("invalid mapping %s for %s", v, d.Name))
+			}
+			ip, err := parseIP(p[1])
+			if err != nil {
+				return err
+			}
+			if d.Mapping == nil {
+				d.Mapping = make(map[string]net.IP)
+			}
+			d.Mapping[p[0]] = ip
+		}
+	case "place":
+		d.Place = value
+	case "model":
+		d.Model = value
+	case "code":
+		d.Code = value
+	case "latitude":
+		d.Latitude, err = parseFloat(value)
+	case "longitude":
+		d.Longitude, err = parseFloat(value)
+	case "height":
+		d.Height, err = parseFloat(value)
+	}
+
+	return err
+}
+
+// WriteCSV encodes the devices as CSV using the CSVColumns layout.
+func (d *Devices) WriteCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+
+	if err := c.Write(CSVColumns); err != nil {
+		return err
+	}
+
+	for _, s := range d.List {
+		row := make([]string, len(CSVColumns))
+		for i, k := range CSVColumns {
+			row[i] = csvValue(s, k)
+		}
+		if err := c.Write(row); err != nil {
+			return err
+		}
+	}
+
+	c.Flush()
+
+	return c.Error()
+}
+
+// ReadCSV decodes devices from CSV, the header row is used to find the columns, unknown columns are ignored.
+func ReadCSV(r io.Reader) (*Devices, error) {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = -1
+
+	header, err := c.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, len(header))
+	var named bool
+	for i, h := range header {
+		columns[i] = strings.ToLower(strings.TrimSpace(h))
+		if columns[i] == "name" {
+			named = true
+		}
+	}
+	if !named {
+		return nil, errors.New("csv header has no name column")
+	}
+
+	d := Devices{}
+	for {
+		row, err := c.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var s Device
+		for i, v := range row {
+			if i >= len(columns) {
+				break
+			}
+			if err := csvDecode(&s, columns[i], v); err != nil {
+				return nil, err
+			}
+		}
+		if s.Name == "" {
+			continue
+		}
+
+		d.List = append(d.List, &s)
+	}
+
+	return &d, nil
+}
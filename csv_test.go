@@ -0,0 +1,56 @@
+package zone
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+
+	d := Devices{List: []*Device{
+		{
+			Name:      "wel-gw.example.com.",
+			IP:        net.ParseIP("10.1.2.3"),
+			IP6:       net.ParseIP("2001:db8::3"),
+			Reverse:   []net.IP{net.ParseIP("10.1.2.3")},
+			Mapping:   map[string]net.IP{"wel-map.example.com.": net.ParseIP("10.1.2.4")},
+			Aliases:   []string{"wel.example.com.", "wel-map.example.com."},
+			Place:     "Wellington, Office",
+			Model:     "Q330",
+			Code:      "WEL",
+			Latitude:  -41.2865,
+			Longitude: 174.7762,
+			Height:    21,
+		},
+	}}
+
+	var b bytes.Buffer
+	if err := d.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ReadCSV(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.List) != 1 || r.List[0].String() != d.List[0].String() {
+		t.Errorf("ReadCSV: %v", r.List)
+	}
+}
+
+func TestReadCSVColumns(t *testing.T) {
+
+	r, err := ReadCSV(strings.NewReader("Code,Name,Notes\nWEL,wel-gw.example.com.,ignored\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.List) != 1 || r.List[0].Name != "wel-gw.example.com." || r.List[0].Code != "WEL" {
+		t.Error("ReadCSV")
+	}
+
+	if _, err := ReadCSV(strings.NewReader("code\nWEL\n")); err == nil {
+		t.Error("ReadCSV: missing name column")
+	}
+}
@@ -15,14 +15,15 @@ const (
 )
 
 // Device describes the DNS stored equipment information.
-// It is assumed that each piece of equipment has a single A record pointing
-// to a definitive DNS Name and Address. Possible equipment Aliases
+// It is assumed that each piece of equipment has a single A (and/or AAAA) record
+// pointing to a definitive DNS Name and Address. Possible equipment Aliases
 // can also be stored via CNAME lookups, likewise Mapping IP addresses can be
 // stored via PTR records pointing to CNAME entries. Also stored are Place,
 // Model details, instrument or site Codes and Place location information.
 type Device struct {
 	Name      string            `json:"name"`      // full dns name
 	IP        net.IP            `json:"ip"`        // primary ip address (A)
+	IP6       net.IP            `json:"ip6"`       // primary ipv6 address (AAAA)
 	Reverse   []net.IP          `json:"reverse"`   // primary lookups (PTR)
 	Mapping   map[string]net.IP `json:"mapping"`   // secondary lookups (PTR/CNAME)
 	Aliases   []string          `json:"aliases"`   // other names (CNAME)
@@ -80,6 +81,9 @@ func (d *Device) HasAddress(ip net.IP) bool {
 	if d.IP.Equal(ip) {
 		return true
 	}
+	if len(d.IP6) > 0 && d.IP6.Equal(ip) {
+		return true
+	}
 	for _, a := range d.Reverse {
 		if !a.Equal(ip) {
 			continue
@@ -92,6 +96,9 @@ func (d *Device) InNetwork(network net.IPNet) bool {
 	if network.Contains(d.IP) {
 		return true
 	}
+	if network.Contains(d.IP6) {
+		return true
+	}
 	for _, a := range d.Reverse {
 		if !network.Contains(a) {
 			continue
@@ -130,6 +137,9 @@ func (d *Device) Equal(device *Device) bool {
 	if !d.HasAddress(device.IP) {
 		return false
 	}
+	if len(device.IP6) > 0 && !d.HasAddress(device.IP6) {
+		return false
+	}
 	if !d.HasCode(device.Code) {
 		return false
 	}
@@ -1,12 +1,16 @@
 package zone
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
 )
 
 type Devices struct {
@@ -14,12 +18,16 @@ type Devices struct {
 }
 
 func LoadLocal(server string, zones, reverse []string) (*Devices, error) {
+	return LoadLocalContext(context.Background(), server, zones, reverse)
+}
+
+func LoadLocalContext(ctx context.Context, server string, zones, reverse []string) (*Devices, error) {
 	s := Service{
 		Server: server,
 		Port:   "53",
 	}
 
-	l, err := s.List(zones, reverse)
+	l, err := s.ListContext(ctx, zones, reverse)
 	if err != nil {
 		return nil, err
 	}
@@ -30,26 +38,31 @@ func LoadLocal(server string, zones, reverse []string) (*Devices, error) {
 }
 
 func LoadRemote(server string) (*Devices, error) {
+	return LoadRemoteContext(context.Background(), server)
+}
+
+func LoadRemoteContext(ctx context.Context, server string) (*Devices, error) {
 
 	s := Service{
 		Server: server,
 		Port:   "9001",
 	}
 
-	host, err := s.ServerPort()
+	host, err := s.ServerPortContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	abs := url.URL{Scheme: "http", Host: host}
+	// the server is given as a host with an optional port, the listing is served from the root
+	abs := url.URL{Scheme: "http", Host: host, Path: "/"}
 
-	u, err := url.Parse(server)
+	req, err := http.NewRequestWithContext(ctx, "GET", abs.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var l []*Device
-	res, err := http.Get(abs.ResolveReference(u).String())
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -58,6 +71,9 @@ func LoadRemote(server string) (*Devices, error) {
 	if err != nil {
 		return nil, err
 	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("invalid remote response from %s: %s", host, res.Status))
+	}
 	err = json.Unmarshal(body, &l)
 	if err != nil {
 		return nil, err
@@ -82,6 +98,9 @@ func (d *Devices) FindByIP(ip net.IP) *Device {
 		if s.IP.Equal(ip) {
 			return s
 		}
+		if len(s.IP6) > 0 && s.IP6.Equal(ip) {
+			return s
+		}
 	}
 	return nil
 }
@@ -250,3 +269,29 @@ func (d *Devices) MustMatchByPlace(place string) *Devices {
 
 	return &l
 }
+
+// FindByAlias finds the device with the given alias, ignoring case.
+func (d *Devices) FindByAlias(alias string) *Device {
+	for _, s := range d.List {
+		for _, a := range s.Aliases {
+			if strings.EqualFold(a, alias) {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// FindByAddress finds the device using the given address, either as its own
+// address, as a reverse entry, or as a mapping entry.
+func (d *Devices) FindByAddress(ip net.IP) *Device {
+	if s := d.FindByIP(ip); s != nil {
+		return s
+	}
+	for _, s := range d.List {
+		if s.HasReverse(ip) || s.HasIP(ip) {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package zone
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Change describes a single field difference between two devices, list fields are given as sorted space separated values.
+type Change struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Field, c.From, c.To)
+}
+
+// DeviceChanges holds the differences found for a device present in both old and new sets.
+type DeviceChanges struct {
+	From    *Device  `json:"from"`
+	To      *Device  `json:"to"`
+	Changes []Change `json:"changes"`
+}
+
+// DevicesChanges classifies the differences between two sets of devices.
+type DevicesChanges struct {
+	Added   []*Device       `json:"added"`
+	Removed []*Device       `json:"removed"`
+	Changed []DeviceChanges `json:"changed"`
+}
+
+// the device fields compared by Diff, independent of the CSV layout
+var diffFields = []string{
+	"name",
+	"ip",
+	"ip6",
+	"reverse",
+	"aliases",
+	"mapping",
+	"place",
+	"model",
+	"code",
+	"latitude",
+	"longitude",
+	"height",
+}
+
+// the comparable value of a device field, names are compared ignoring case
+func diffValue(d *Device, field string) string {
+	switch field {
+	case "name":
+		return strings.ToLower(d.Name)
+	case "reverse":
+		l := strings.Fields(csvValue(d, field))
+		sort.Strings(l)
+		return strings.Join(l, " ")
+	case "aliases":
+		var l []string
+		for _, a := range d.Aliases {
+			l = append(l, strings.ToLower(a))
+		}
+		sort.Strings(l)
+		return strings.Join(l, " ")
+	case "mapping":
+		var l []string
+		for n, ip := range d.Mapping {
+			l = append(l, strings.ToLower(n)+"="+ip.String())
+		}
+		sort.Strings(l)
+		return strings.Join(l, " ")
+	}
+	return csvValue(d, field)
+}
+
+// Diff reports the field by field differences between two devices, locations are only
+// reported as changed if they differ by more than the LOC record precision.
+func Diff(from, to *Device) []Change {
+	var res []Change
+
+	for _, k := range diffFields {
+		switch k {
+		case "latitude":
+			if math.Abs(from.Latitude-to.Latitude) < 0.5/LOC_DEGREES {
+				continue
+			}
+		case "longitude":
+			if math.Abs(from.Longitude-to.Longitude) < 0.5/LOC_DEGREES {
+				continue
+			}
+		case "height":
+			if math.Abs(from.Height-to.Height) < 0.005 {
+				continue
+			}
+		default:
+			if diffValue(from, k) == diffValue(to, k) {
+				continue
+			}
+		}
+
+		res = append(res, Change{Field: k, From: diffValue(from, k), To: diffValue(to, k)})
+	}
+
+	return res
+}
+
+// DevicesDiff classifies the added, removed and changed devices between two sets, devices are matched by name.
+func DevicesDiff(old, new *Devices) *DevicesChanges {
+	var res DevicesChanges
+
+	before := make(map[string]*Device)
+	for _, d := range old.List {
+		before[strings.ToLower(d.Name)] = d
+	}
+	after := make(map[string]*Device)
+	for _, d := range new.List {
+		after[strings.ToLower(d.Name)] = d
+	}
+
+	var keys []string
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		f, t := before[k], after[k]
+		switch {
+		case f == nil:
+			res.Added = append(res.Added, t)
+		case t == nil:
+			res.Removed = append(res.Removed, f)
+		default:
+			if c := Diff(f, t); len(c) > 0 {
+				res.Changed = append(res.Changed, DeviceChanges{From: f, To: t, Changes: c})
+			}
+		}
+	}
+
+	return &res
+}
+
+// Empty indicates whether there are no differences.
+func (c *DevicesChanges) Empty() bool {
+	return !(len(c.Added) > 0) && !(len(c.Removed) > 0) && !(len(c.Changed) > 0)
+}
+
+// String provides a readable summary of the differences, one line per added or removed device,
+// and one line per changed field.
+func (c *DevicesChanges) String() string {
+	var l []string
+
+	for _, d := range c.Added {
+		l = append(l, "+ "+d.Name)
+	}
+	for _, d := range c.Removed {
+		l = append(l, "- "+d.Name)
+	}
+	for _, d := range c.Changed {
+		for _, x := range d.Changes {
+			l = append(l, "~ "+d.To.Name+" "+x.String())
+		}
+	}
+
+	if !(len(l) > 0) {
+		return ""
+	}
+
+	return strings.Join(l, "\n") + "\n"
+}
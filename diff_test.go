@@ -0,0 +1,63 @@
+package zone
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+
+	from := Device{
+		Name:     "wel-gw.example.com.",
+		IP:       net.ParseIP("10.1.2.3"),
+		Aliases:  []string{"a.example.com.", "b.example.com."},
+		Place:    "Wellington",
+		Latitude: -41.2865,
+	}
+	to := Device{
+		Name:     "WEL-GW.example.com.",
+		IP:       net.ParseIP("10.1.2.3"),
+		Aliases:  []string{"b.example.com.", "c.example.com."},
+		Place:    "Wellington",
+		Latitude: -41.28650000001,
+		Height:   21,
+	}
+
+	c := Diff(&from, &to)
+	if len(c) != 2 || c[0].Field != "aliases" || c[1].Field != "height" {
+		t.Errorf("Diff: %v", c)
+	}
+
+	// alias and mapping names ignore case
+	from.Aliases, to.Aliases = []string{"A.example.com."}, []string{"a.EXAMPLE.com."}
+	from.Mapping = map[string]net.IP{"Map.example.com.": net.ParseIP("10.1.2.4")}
+	to.Mapping = map[string]net.IP{"map.example.com.": net.ParseIP("10.1.2.4")}
+	if c := Diff(&from, &to); len(c) != 1 || c[0].Field != "height" {
+		t.Errorf("Diff: %v", c)
+	}
+
+	// changing the csv layout doesn't change the compared fields
+	columns := CSVColumns
+	CSVColumns = []string{"name"}
+	defer func() { CSVColumns = columns }()
+	if c := Diff(&from, &to); len(c) != 1 || c[0].Field != "height" {
+		t.Errorf("Diff: %v", c)
+	}
+}
+
+func TestDevicesDiff(t *testing.T) {
+
+	old := Devices{List: []*Device{{Name: "a."}, {Name: "b.", Code: "WEL"}}}
+	new := Devices{List: []*Device{{Name: "b.", Code: "AKL"}, {Name: "c."}}}
+
+	c := DevicesDiff(&old, &new)
+	if len(c.Added) != 1 || c.Added[0].Name != "c." {
+		t.Error("DevicesDiff: added")
+	}
+	if len(c.Removed) != 1 || c.Removed[0].Name != "a." {
+		t.Error("DevicesDiff: removed")
+	}
+	if len(c.Changed) != 1 || c.String() != "+ c.\n- a.\n~ b. code: \"WEL\" -> \"AKL\"\n" {
+		t.Errorf("DevicesDiff: %q", c.String())
+	}
+}
@@ -0,0 +1,189 @@
+package zone
+
+import (
+	"context"
+	"errors"
+	"github.com/miekg/dns"
+	"net"
+)
+
+// Directory is the common device lookup interface provided by live DNS (Service or Equipment),
+// a remote HTTP inventory (via LoadRemote) or a cached snapshot (Devices or Cache). Devices
+// that can't be found are returned as nil without an error.
+type Directory interface {
+	Find(ctx context.Context, name string) (*Device, error)
+	FindByIP(ctx context.Context, ip net.IP) (*Device, error)
+	ListByModel(ctx context.Context, model string) (*Devices, error)
+	ListByCode(ctx context.Context, code string) (*Devices, error)
+	ListByPlace(ctx context.Context, place string) (*Devices, error)
+	ListByNetwork(ctx context.Context, network net.IPNet) (*Devices, error)
+}
+
+// missing names and addresses are not lookup errors
+func notFound(d *Device, err error) (*Device, error) {
+	if errors.Is(err, ErrNXDomain) {
+		return nil, nil
+	}
+	var e *net.DNSError
+	if errors.As(err, &e) && e.IsNotFound {
+		return nil, nil
+	}
+	return d, err
+}
+
+type devicesDirectory struct {
+	devices func() *IndexedDevices
+}
+
+// NewDevicesDirectory provides a Directory for an indexed snapshot of devices, later
+// changes to the devices aren't seen.
+func NewDevicesDirectory(devices *Devices) Directory {
+	x := NewIndexedDevices(devices)
+	return &devicesDirectory{devices: func() *IndexedDevices { return x }}
+}
+
+// NewCacheDirectory provides a Directory for the devices currently held in a cache.
+func NewCacheDirectory(cache *Cache) Directory {
+	return &devicesDirectory{devices: cache.Index}
+}
+
+// names can also be aliases, as they would be resolved via DNS
+func (d *devicesDirectory) Find(ctx context.Context, name string) (*Device, error) {
+	devices := d.devices()
+	if s := devices.Find(name); s != nil {
+		return s, nil
+	}
+	if s := devices.Find(dns.Fqdn(name)); s != nil {
+		return s, nil
+	}
+	return devices.FindByAlias(dns.Fqdn(name)), nil
+}
+
+// addresses can also be reverse or mapping entries, as they would be resolved via DNS
+func (d *devicesDirectory) FindByIP(ctx context.Context, ip net.IP) (*Device, error) {
+	return d.devices().FindByAddress(ip), nil
+}
+
+func (d *devicesDirectory) ListByModel(ctx context.Context, model string) (*Devices, error) {
+	return d.devices().ListByModel(model), nil
+}
+
+func (d *devicesDirectory) ListByCode(ctx context.Context, code string) (*Devices, error) {
+	return d.devices().ListByCode(code), nil
+}
+
+func (d *devicesDirectory) ListByPlace(ctx context.Context, place string) (*Devices, error) {
+	return d.devices().ListByPlace(place), nil
+}
+
+func (d *devicesDirectory) ListByNetwork(ctx context.Context, network net.IPNet) (*Devices, error) {
+	return d.devices().ListByNetwork(network), nil
+}
+
+type serviceDirectory struct {
+	service *Service
+	zones   []string
+	reverse []string
+}
+
+// NewServiceDirectory provides a Directory using live DNS lookups, the lists are built
+// from transfers of the given forward and reverse zones.
+func NewServiceDirectory(service *Service, zones, reverse []string) Directory {
+	return &serviceDirectory{service: service, zones: zones, reverse: reverse}
+}
+
+func (s *serviceDirectory) list(ctx context.Context) (*Devices, error) {
+	l, err := s.service.ListContext(ctx, s.zones, s.reverse)
+	if err != nil {
+		return nil, err
+	}
+	return &Devices{List: l}, nil
+}
+
+func (s *serviceDirectory) Find(ctx context.Context, name string) (*Device, error) {
+	return notFound(s.service.FindContext(ctx, name))
+}
+
+func (s *serviceDirectory) FindByIP(ctx context.Context, ip net.IP) (*Device, error) {
+	return notFound(s.service.FindByIPContext(ctx, ip))
+}
+
+func (s *serviceDirectory) ListByModel(ctx context.Context, model string) (*Devices, error) {
+	d, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.ListByModel(model), nil
+}
+
+func (s *serviceDirectory) ListByCode(ctx context.Context, code string) (*Devices, error) {
+	d, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.ListByCode(code), nil
+}
+
+func (s *serviceDirectory) ListByPlace(ctx context.Context, place string) (*Devices, error) {
+	d, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.ListByPlace(place), nil
+}
+
+func (s *serviceDirectory) ListByNetwork(ctx context.Context, network net.IPNet) (*Devices, error) {
+	d, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.ListByNetwork(network), nil
+}
+
+type equipmentDirectory struct {
+	equipment *Equipment
+}
+
+// NewEquipmentDirectory provides a Directory for the legacy Equipment lookups, these
+// don't support contexts.
+func NewEquipmentDirectory(equipment *Equipment) Directory {
+	return &equipmentDirectory{equipment: equipment}
+}
+
+// convert an equipment device list
+func equipmentDevices(l []Device, err error) (*Devices, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	d := Devices{}
+	for i := range l {
+		d.List = append(d.List, &l[i])
+	}
+
+	return &d, nil
+}
+
+func (e *equipmentDirectory) Find(ctx context.Context, name string) (*Device, error) {
+	return notFound(e.equipment.Find(name))
+}
+
+func (e *equipmentDirectory) FindByIP(ctx context.Context, ip net.IP) (*Device, error) {
+	return notFound(e.equipment.FindByIP(ip))
+}
+
+func (e *equipmentDirectory) ListByModel(ctx context.Context, model string) (*Devices, error) {
+	return equipmentDevices(e.equipment.ListByModel(model))
+}
+
+func (e *equipmentDirectory) ListByCode(ctx context.Context, code string) (*Devices, error) {
+	return equipmentDevices(e.equipment.ListByCode(code))
+}
+
+func (e *equipmentDirectory) ListByPlace(ctx context.Context, place string) (*Devices, error) {
+	return equipmentDevices(e.equipment.ListByPlace(place))
+}
+
+func (e *equipmentDirectory) ListByNetwork(ctx context.Context, network net.IPNet) (*Devices, error) {
+	return equipmentDevices(e.equipment.ListByNetwork(network))
+}
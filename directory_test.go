@@ -0,0 +1,77 @@
+package zone
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirectory(t *testing.T) {
+	srv, s := testService(t)
+
+	devices, err := LoadZoneFiles(
+		[]string{filepath.Join("testdata", "db.example.com")},
+		[]string{filepath.Join("testdata", "10.in-addr.arpa.zone")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, network, err := net.ParseCIDR("10.1.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for n, d := range map[string]Directory{
+		"devices":   NewDevicesDirectory(devices),
+		"service":   NewServiceDirectory(s, []string{"example.com."}, []string{"10.in-addr.arpa."}),
+		"equipment": NewEquipmentDirectory(&Equipment{Zone: "example.com.", Server: srv.Host(), Port: srv.Port(), Resolver: s.Resolver}),
+	} {
+		f, err := d.Find(ctx, "wel-gw.example.com")
+		if err != nil {
+			t.Fatalf("%s: %v", n, err)
+		}
+		if f == nil || f.Name != "wel-gw.example.com." || f.Model != "Q330" {
+			t.Errorf("%s: Find %v", n, f)
+		}
+
+		f, err = d.Find(ctx, "wel.example.com")
+		if err != nil || f == nil || f.Name != "wel-gw.example.com." {
+			t.Errorf("%s: Find alias %v %v", n, f, err)
+		}
+
+		f, err = d.Find(ctx, "missing.example.com")
+		if err != nil || f != nil {
+			t.Errorf("%s: Find missing %v %v", n, f, err)
+		}
+
+		for _, a := range []string{"10.1.2.3", "10.1.2.4"} {
+			f, err = d.FindByIP(ctx, net.ParseIP(a))
+			if err != nil || f == nil || f.Name != "wel-gw.example.com." {
+				t.Errorf("%s: FindByIP %s %v %v", n, a, f, err)
+			}
+		}
+
+		f, err = d.FindByIP(ctx, net.ParseIP("10.9.9.9"))
+		if err != nil || f != nil {
+			t.Errorf("%s: FindByIP missing %v %v", n, f, err)
+		}
+
+		for k, fn := range map[string]func() (*Devices, error){
+			"ListByModel":   func() (*Devices, error) { return d.ListByModel(ctx, "Q330") },
+			"ListByCode":    func() (*Devices, error) { return d.ListByCode(ctx, "WEL") },
+			"ListByPlace":   func() (*Devices, error) { return d.ListByPlace(ctx, "Wellington Office") },
+			"ListByNetwork": func() (*Devices, error) { return d.ListByNetwork(ctx, *network) },
+		} {
+			l, err := fn()
+			if err != nil {
+				t.Fatalf("%s: %s %v", n, k, err)
+			}
+			if len(l.List) != 1 || l.List[0].Name != "wel-gw.example.com." {
+				t.Errorf("%s: %s %v", n, k, l.List)
+			}
+		}
+	}
+}
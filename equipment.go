@@ -1,13 +1,13 @@
 package zone
 
 import (
-	"errors"
-	"fmt"
+	"context"
 	"github.com/miekg/dns"
 	"net"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 )
 
 const (
@@ -18,6 +18,16 @@ type Equipment struct {
 	Zone   string
 	Server string
 	Port   string
+
+	Resolver *net.Resolver // system lookups of the server address and FindByIP, defaults to net.DefaultResolver
+}
+
+// the resolver used for system lookups
+func (e *Equipment) resolver() *net.Resolver {
+	if e.Resolver == nil {
+		return net.DefaultResolver
+	}
+	return e.Resolver
 }
 
 func (e *Equipment) transfer() ([]dns.RR, error) {
@@ -29,26 +39,18 @@ func (e *Equipment) transfer() ([]dns.RR, error) {
 		port = DEF_PORT
 	}
 
-	s, err := net.LookupHost(e.Server)
+	s, err := e.resolver().LookupHost(context.Background(), e.Server)
 	if err != nil {
 		return nil, err
 	}
 
-	tr := new(dns.Transfer)
-	a, err := tr.In(m, net.JoinHostPort(s[0], port))
+	co, err := dns.Dial("tcp", net.JoinHostPort(s[0], port))
 	if err != nil {
 		return nil, err
 	}
+	defer co.Close()
 
-	var res []dns.RR
-	for ex := range a {
-		if ex.Error != nil {
-			return nil, ex.Error
-		}
-		res = append(res, ex.RR...)
-	}
-
-	return res, nil
+	return readTransfer(&dns.Transfer{Conn: co}, m, e.Server)
 }
 
 func (e *Equipment) lookup(name string, record uint16) ([]dns.RR, error) {
@@ -63,12 +65,9 @@ func (e *Equipment) lookup(name string, record uint16) ([]dns.RR, error) {
 
 	c := new(dns.Client)
 	r, _, err := c.Exchange(m, net.JoinHostPort(e.Server, port))
-	if err != nil {
+	if err := checkResponse("lookup", e.Server, "", dns.Fqdn(name), r, err); err != nil {
 		return nil, err
 	}
-	if r.Rcode != dns.RcodeSuccess {
-		return nil, errors.New(fmt.Sprintf("invalid lookup answer for %s", name))
-	}
 
 	return r.Answer, nil
 }
@@ -81,6 +80,8 @@ func (e *Equipment) decode(records []dns.RR) (*Device, error) {
 		switch x := r.(type) {
 		case *dns.A:
 			d.IP = CopyIP(x.A)
+		case *dns.AAAA:
+			d.IP6 = CopyIP(x.AAAA)
 		case *dns.CNAME:
 		case *dns.TXT:
 			d.Place = strings.Join(x.Txt, " ")
@@ -96,31 +97,39 @@ func (e *Equipment) decode(records []dns.RR) (*Device, error) {
 }
 
 func (e *Equipment) gather(name string) (*Device, error) {
-	var res []dns.RR
 
-	// search for an A record
-	ans, err := e.lookup(name, dns.TypeA)
-	if err != nil {
-		return nil, err
+	// run the record lookups concurrently
+	types := []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeTXT, dns.TypeHINFO, dns.TypeLOC}
+
+	answers := make([][]dns.RR, len(types))
+	errs := make([]error, len(types))
+
+	var wg sync.WaitGroup
+	for i, t := range types {
+		wg.Add(1)
+		go func(i int, t uint16) {
+			defer wg.Done()
+			answers[i], errs[i] = e.lookup(name, t)
+		}(i, t)
 	}
-	// we need at least one
-	if !(len(ans) > 0) {
-		return nil, nil
+	wg.Wait()
+
+	// the A record search must succeed
+	if errs[0] != nil {
+		return nil, errs[0]
 	}
-	res = append(res, ans...)
 
 	// gather other records ...
-	txt, err := e.lookup(name, dns.TypeTXT)
-	if err == nil {
-		res = append(res, txt...)
-	}
-	hinfo, err := e.lookup(name, dns.TypeHINFO)
-	if err == nil {
-		res = append(res, hinfo...)
+	var res []dns.RR
+	for i := range types {
+		if errs[i] == nil {
+			res = append(res, answers[i]...)
+		}
 	}
-	loc, err := e.lookup(name, dns.TypeLOC)
-	if err == nil {
-		res = append(res, loc...)
+
+	// we need at least one address
+	if !(len(answers[0]) > 0) && !(len(answers[1]) > 0) {
+		return nil, nil
 	}
 
 	return e.decode(res)
@@ -135,11 +144,17 @@ func (e *Equipment) List() ([]Device, error) {
 
 	devices := make(map[string]Device)
 
-	// only collect A record details ...
+	// only collect A and AAAA record details ...
 	for _, r := range rr {
 		switch x := r.(type) {
 		case *dns.A:
-			devices[r.Header().Name] = Device{Name: r.Header().Name, IP: CopyIP(x.A)}
+			d := devices[r.Header().Name]
+			d.Name, d.IP = r.Header().Name, CopyIP(x.A)
+			devices[r.Header().Name] = d
+		case *dns.AAAA:
+			d := devices[r.Header().Name]
+			d.Name, d.IP6 = r.Header().Name, CopyIP(x.AAAA)
+			devices[r.Header().Name] = d
 		}
 	}
 
@@ -151,6 +166,7 @@ func (e *Equipment) List() ([]Device, error) {
 		}
 		switch x := r.(type) {
 		case *dns.A:
+		case *dns.AAAA:
 		case *dns.CNAME:
 		case *dns.TXT:
 			d.Place = strings.Join(x.Txt, " ")
@@ -184,7 +200,7 @@ func (e *Equipment) Find(name string) (*Device, error) {
 }
 
 func (e *Equipment) FindByIP(ip net.IP) (*Device, error) {
-	s, err := net.LookupAddr(ip.String())
+	s, err := e.resolver().LookupAddr(context.Background(), ip.String())
 	if err != nil {
 		return nil, err
 	}
@@ -276,7 +292,7 @@ func (e *Equipment) ListByNetwork(network net.IPNet) ([]Device, error) {
 
 	res := make([]Device, 0, len(devices))
 	for _, d := range devices {
-		if !network.Contains(d.IP) {
+		if !d.InNetwork(network) {
 			continue
 		}
 
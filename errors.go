@@ -0,0 +1,100 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"strings"
+)
+
+// Sentinel errors matched by RcodeError via errors.Is.
+var (
+	ErrNXDomain = errors.New("non-existent domain")
+	ErrRefused  = errors.New("request refused")
+	ErrNotAuth  = errors.New("server not authoritative or not authorised")
+	ErrTsig     = errors.New("tsig verification failed")
+)
+
+// RcodeError describes an unsuccessful DNS response, or a failed TSIG verification.
+type RcodeError struct {
+	Op     string // lookup, transfer or update
+	Server string
+	Zone   string
+	Name   string
+	Rcode  int   // response code, or the TSIG error for TSIG failures
+	Err    error // underlying error, if any
+}
+
+func (e *RcodeError) Error() string {
+	var l []string
+
+	l = append(l, e.Op)
+	if e.Name != "" {
+		l = append(l, e.Name)
+	}
+	if e.Zone != "" {
+		l = append(l, "in "+e.Zone)
+	}
+	if e.Server != "" {
+		l = append(l, "via "+e.Server)
+	}
+
+	rcode, ok := dns.RcodeToString[e.Rcode]
+	if !ok {
+		rcode = fmt.Sprintf("RCODE%d", e.Rcode)
+	}
+
+	msg := strings.Join(l, " ") + ": " + rcode
+	if e.Err != nil {
+		msg = msg + ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e *RcodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the response code against the sentinel errors.
+func (e *RcodeError) Is(target error) bool {
+	switch target {
+	case ErrNXDomain:
+		return e.Rcode == dns.RcodeNameError
+	case ErrRefused:
+		return e.Rcode == dns.RcodeRefused
+	case ErrNotAuth:
+		return e.Rcode == dns.RcodeNotAuth
+	case ErrTsig:
+		return e.Rcode == dns.RcodeBadSig || e.Rcode == dns.RcodeBadKey || e.Rcode == dns.RcodeBadTime
+	}
+	return false
+}
+
+// check a response, returning an RcodeError for unsuccessful or unverified answers
+func checkResponse(op, server, zone, name string, r *dns.Msg, err error) error {
+	switch {
+	case err == dns.ErrSig || err == dns.ErrKey || err == dns.ErrTime || err == dns.ErrAuth:
+		// a NOTAUTH response holds the TSIG error of the request, as per RFC 8945
+		rcode := dns.RcodeBadSig
+		if r != nil {
+			if t := r.IsTsig(); t != nil && t.Error != 0 {
+				rcode = int(t.Error)
+			} else if err == dns.ErrAuth {
+				rcode = r.Rcode
+			}
+		}
+		return &RcodeError{Op: op, Server: server, Zone: zone, Name: name, Rcode: rcode, Err: err}
+	case err != nil:
+		return err
+	}
+
+	if t := r.IsTsig(); t != nil && t.Error != 0 {
+		return &RcodeError{Op: op, Server: server, Zone: zone, Name: name, Rcode: int(t.Error)}
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return &RcodeError{Op: op, Server: server, Zone: zone, Name: name, Rcode: r.Rcode}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package zone
+
+import (
+	"errors"
+	"github.com/miekg/dns"
+	"testing"
+)
+
+func TestRcodeError(t *testing.T) {
+	var tests = []struct {
+		rcode int
+		match error
+		not   error
+	}{
+		{dns.RcodeNameError, ErrNXDomain, ErrRefused},
+		{dns.RcodeRefused, ErrRefused, ErrNotAuth},
+		{dns.RcodeNotAuth, ErrNotAuth, ErrTsig},
+		{dns.RcodeBadSig, ErrTsig, ErrNXDomain},
+		{dns.RcodeBadTime, ErrTsig, ErrNotAuth},
+	}
+
+	for _, x := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion("test.example.com.", dns.TypeA)
+		r.Rcode = x.rcode
+
+		err := checkResponse("lookup", "127.0.0.1:53", "", "test.example.com.", r, nil)
+		if err == nil {
+			t.Fatalf("expected an error for rcode %d", x.rcode)
+		}
+		if !errors.Is(err, x.match) {
+			t.Errorf("rcode %d should match %v", x.rcode, x.match)
+		}
+		if errors.Is(err, x.not) {
+			t.Errorf("rcode %d should not match %v", x.rcode, x.not)
+		}
+
+		var e *RcodeError
+		if !errors.As(err, &e) {
+			t.Fatalf("rcode %d should be an RcodeError", x.rcode)
+		}
+		if e.Rcode != x.rcode || e.Name != "test.example.com." || e.Op != "lookup" {
+			t.Errorf("unexpected error details: %v", e)
+		}
+	}
+
+	r := new(dns.Msg)
+	r.SetQuestion("example.com.", dns.TypeSOA)
+	r.Rcode = dns.RcodeNotAuth
+	r.SetTsig("test.key.", dns.HmacSHA256, 300, 0)
+	r.Extra[0].(*dns.TSIG).Error = dns.RcodeBadKey
+	if err := checkResponse("update", "127.0.0.1:53", "example.com.", "", r, nil); !errors.Is(err, ErrTsig) {
+		t.Errorf("tsig error should match %v: %v", ErrTsig, err)
+	}
+
+	// the dns library reports unsigned NOTAUTH responses as authentication errors
+	var e *RcodeError
+	if err := checkResponse("update", "127.0.0.1:53", "example.com.", "", r, dns.ErrAuth); !errors.As(err, &e) || e.Rcode != dns.RcodeBadKey || !errors.Is(err, ErrTsig) {
+		t.Errorf("tsig error should match %v: %v", ErrTsig, err)
+	}
+	if err := checkResponse("update", "127.0.0.1:53", "example.com.", "", nil, dns.ErrSig); !errors.Is(err, ErrTsig) || !errors.Is(err, dns.ErrSig) {
+		t.Errorf("signature error should match %v: %v", ErrTsig, err)
+	}
+}
+
+func TestServiceErrors(t *testing.T) {
+	_, s := testService(t)
+
+	var e *RcodeError
+	for _, q := range []uint16{dns.TypeAXFR, dns.TypeIXFR} {
+		var err error
+		switch q {
+		case dns.TypeAXFR:
+			_, err = s.Transfer("example.org.")
+		default:
+			_, err = s.TransferIncremental("example.org.", 1)
+		}
+		if !errors.As(err, &e) || e.Op != "transfer" || e.Zone != "example.org." || !errors.Is(err, ErrNotAuth) {
+			t.Errorf("%s: expected %v, found %v", dns.TypeToString[q], ErrNotAuth, err)
+		}
+	}
+
+	if _, err := (&Equipment{Zone: "example.org.", Server: s.Server, Port: s.Port}).List(); !errors.Is(err, ErrNotAuth) {
+		t.Errorf("Equipment: expected %v, found %v", ErrNotAuth, err)
+	}
+
+	if z, err := s.FindZone("missing.example.com"); err != nil || z != "example.com." {
+		t.Errorf("FindZone: missing name %q %v", z, err)
+	}
+	if _, err := s.FindZone("example.org"); !errors.As(err, &e) || !errors.Is(err, ErrRefused) {
+		t.Errorf("FindZone: expected %v, found %v", ErrRefused, err)
+	}
+}
@@ -0,0 +1,450 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Predicate decides whether a device should be selected.
+type Predicate func(*Device) bool
+
+// Filter returns the devices that match the predicate.
+func (d *Devices) Filter(pred Predicate) *Devices {
+	l := Devices{}
+
+	for _, s := range d.List {
+		if !pred(s) {
+			continue
+		}
+		l.List = append(l.List, s)
+	}
+
+	return &l
+}
+
+// All matches every device.
+func All() Predicate {
+	return func(*Device) bool { return true }
+}
+
+// And matches devices that match all of the predicates.
+func And(preds ...Predicate) Predicate {
+	return func(d *Device) bool {
+		for _, p := range preds {
+			if !p(d) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches devices that match any of the predicates.
+func Or(preds ...Predicate) Predicate {
+	return func(d *Device) bool {
+		for _, p := range preds {
+			if p(d) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches devices that don't match the predicate.
+func Not(pred Predicate) Predicate {
+	return func(d *Device) bool {
+		return !pred(d)
+	}
+}
+
+// ByName matches the device name, ignoring case and any trailing dot.
+func ByName(name string) Predicate {
+	return func(d *Device) bool {
+		return d.HasName(name) || d.HasName(dns.Fqdn(name))
+	}
+}
+
+func ByNameRegex(re *regexp.Regexp) Predicate {
+	return func(d *Device) bool {
+		return re.MatchString(d.Name)
+	}
+}
+
+func ByModel(model string) Predicate {
+	return func(d *Device) bool {
+		return d.HasModel(model)
+	}
+}
+
+func ByModelRegex(re *regexp.Regexp) Predicate {
+	return func(d *Device) bool {
+		return re.MatchString(d.Model)
+	}
+}
+
+func ByCode(code string) Predicate {
+	return func(d *Device) bool {
+		return d.HasCode(code)
+	}
+}
+
+func ByCodeRegex(re *regexp.Regexp) Predicate {
+	return func(d *Device) bool {
+		return re.MatchString(d.Code)
+	}
+}
+
+func ByPlace(place string) Predicate {
+	return func(d *Device) bool {
+		return d.AtPlace(place)
+	}
+}
+
+func ByPlaceRegex(re *regexp.Regexp) Predicate {
+	return func(d *Device) bool {
+		return re.MatchString(d.Place)
+	}
+}
+
+// ByIP matches any of the device addresses.
+func ByIP(ip net.IP) Predicate {
+	return func(d *Device) bool {
+		return d.HasAddress(ip)
+	}
+}
+
+func InNetwork(network net.IPNet) Predicate {
+	return func(d *Device) bool {
+		return d.InNetwork(network)
+	}
+}
+
+// WithinRadius matches located devices within the given distance (km) of a point.
+func WithinRadius(lat, lon, km float64) Predicate {
+	return func(d *Device) bool {
+		return d.HasLocation() && !(d.DistanceTo(lat, lon) > km)
+	}
+}
+
+// HasAlias matches the device aliases, ignoring any trailing dot.
+func HasAlias(alias string) Predicate {
+	return func(d *Device) bool {
+		return d.HasAlias(alias) || d.HasAlias(dns.Fqdn(alias))
+	}
+}
+
+func ByAliasRegex(re *regexp.Regexp) Predicate {
+	return func(d *Device) bool {
+		for _, a := range d.Aliases {
+			if re.MatchString(a) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// query token types
+const (
+	queryWord = iota
+	queryString
+	queryOp
+	queryOpen
+	queryClose
+)
+
+type queryToken struct {
+	kind  int
+	value string
+}
+
+// split a query into tokens
+func queryTokens(q string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	r := []rune(q)
+	for i := 0; i < len(r); {
+		switch c := r[i]; {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: queryOpen, value: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: queryClose, value: ")"})
+			i++
+		case c == '=' || c == '~':
+			tokens = append(tokens, queryToken{kind: queryOp, value: string(c)})
+			i++
+		case c == '!':
+			if i+1 >= len(r) || (r[i+1] != '=' && r[i+1] != '~') {
+				return nil, errors.New(fmt.Sprintf("invalid query operator at %d", i))
+			}
+			tokens = append(tokens, queryToken{kind: queryOp, value: string(r[i : i+2])})
+			i += 2
+		case c == '"':
+			j := i + 1
+			for ; j < len(r) && r[j] != '"'; j++ {
+				if r[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(r) {
+				return nil, errors.New(fmt.Sprintf("unterminated query string at %d", i))
+			}
+			s, err := strconv.Unquote(string(r[i : j+1]))
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid query string at %d: %v", i, err))
+			}
+			tokens = append(tokens, queryToken{kind: queryString, value: s})
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(r) && !unicode.IsSpace(r[j]) && !strings.ContainsRune("()=~!\"", r[j]); j++ {
+			}
+			tokens = append(tokens, queryToken{kind: queryWord, value: string(r[i:j])})
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// check whether the next token is the given keyword, consuming it if so
+func (p *queryParser) keyword(k string) bool {
+	if t := p.peek(); t != nil && t.kind == queryWord && strings.EqualFold(t.value, k) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) or() (Predicate, error) {
+	pred, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	preds := []Predicate{pred}
+	for p.keyword("or") {
+		pred, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+	}
+	if len(preds) == 1 {
+		return preds[0], nil
+	}
+	return Or(preds...), nil
+}
+
+func (p *queryParser) and() (Predicate, error) {
+	pred, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	preds := []Predicate{pred}
+	for p.keyword("and") {
+		pred, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+	}
+	if len(preds) == 1 {
+		return preds[0], nil
+	}
+	return And(preds...), nil
+}
+
+func (p *queryParser) unary() (Predicate, error) {
+	if p.keyword("not") {
+		pred, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(pred), nil
+	}
+
+	t := p.peek()
+	switch {
+	case t == nil:
+		return nil, errors.New("unexpected end of query")
+	case t.kind == queryOpen:
+		p.pos++
+		pred, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.kind != queryClose {
+			return nil, errors.New("missing closing parenthesis in query")
+		}
+		p.pos++
+		return pred, nil
+	case t.kind != queryWord:
+		return nil, errors.New(fmt.Sprintf("unexpected %q in query", t.value))
+	}
+
+	return p.term()
+}
+
+// a single field comparison, e.g. model~"Q330.*"
+func (p *queryParser) term() (Predicate, error) {
+	field := strings.ToLower(p.tokens[p.pos].value)
+	p.pos++
+
+	op := p.peek()
+	if op == nil || op.kind != queryOp {
+		return nil, errors.New(fmt.Sprintf("missing operator after %s in query", field))
+	}
+	p.pos++
+
+	v := p.peek()
+	if v == nil || (v.kind != queryWord && v.kind != queryString) {
+		return nil, errors.New(fmt.Sprintf("missing value after %s%s in query", field, op.value))
+	}
+	p.pos++
+
+	pred, err := queryPredicate(field, strings.TrimPrefix(op.value, "!"), v.value)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(op.value, "!") {
+		return Not(pred), nil
+	}
+
+	return pred, nil
+}
+
+// build the predicate for a field comparison, op is either "=" or "~"
+func queryPredicate(field, op, value string) (Predicate, error) {
+	var re *regexp.Regexp
+	if op == "~" {
+		r, err := regexp.Compile(value)
+		if err != nil {
+			return nil, err
+		}
+		re = r
+	}
+
+	switch field {
+	case "name":
+		if re != nil {
+			return ByNameRegex(re), nil
+		}
+		return ByName(value), nil
+	case "model":
+		if re != nil {
+			return ByModelRegex(re), nil
+		}
+		return ByModel(value), nil
+	case "code":
+		if re != nil {
+			return ByCodeRegex(re), nil
+		}
+		return ByCode(value), nil
+	case "place":
+		if re != nil {
+			return ByPlaceRegex(re), nil
+		}
+		return ByPlace(value), nil
+	case "alias":
+		if re != nil {
+			return ByAliasRegex(re), nil
+		}
+		return HasAlias(value), nil
+	}
+
+	if re != nil {
+		return nil, errors.New(fmt.Sprintf("query field %s can't be matched with ~", field))
+	}
+
+	switch field {
+	case "ip":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, errors.New(fmt.Sprintf("invalid query address %s", value))
+		}
+		return ByIP(ip), nil
+	case "net", "network":
+		_, n, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		return InNetwork(*n), nil
+	case "within":
+		p := strings.Split(value, ",")
+		if len(p) != 3 {
+			return nil, errors.New(fmt.Sprintf("invalid query radius %s, expected lat,lon,km", value))
+		}
+		var f [3]float64
+		for i := range p {
+			v, err := strconv.ParseFloat(strings.TrimSpace(p[i]), 64)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid query radius %s, expected lat,lon,km", value))
+			}
+			f[i] = v
+		}
+		return WithinRadius(f[0], f[1], f[2]), nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("unknown query field %s", field))
+}
+
+// ParseQuery builds a predicate from a textual query made up of field comparisons joined
+// with "and", "or", "not" and parentheses, e.g.
+//
+//	model~"Q330.*" and code=WEL and net=10.1.0.0/16
+//
+// The fields are name, model, code, place, alias, ip, net and within (lat,lon,km). The
+// operators are = and != for equality, or ~ and !~ for regular expression matches. Values
+// containing spaces or operators need to be quoted. An empty query matches every device.
+func ParseQuery(q string) (Predicate, error) {
+	tokens, err := queryTokens(q)
+	if err != nil {
+		return nil, err
+	}
+	if !(len(tokens) > 0) {
+		return All(), nil
+	}
+
+	p := queryParser{tokens: tokens}
+
+	pred, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != nil {
+		return nil, errors.New(fmt.Sprintf("unexpected %q in query", t.value))
+	}
+
+	return pred, nil
+}
+
+// Query returns the devices matching a textual query, as described by ParseQuery.
+func (d *Devices) Query(q string) (*Devices, error) {
+	pred, err := ParseQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	return d.Filter(pred), nil
+}
@@ -0,0 +1,88 @@
+package zone
+
+import (
+	"net"
+	"regexp"
+	"testing"
+)
+
+func testDevices() *Devices {
+	return &Devices{List: []*Device{
+		{Name: "wel-gw.example.com.", IP: net.ParseIP("10.1.2.3"), Model: "Q330", Code: "WEL", Place: "Wellington Office", Aliases: []string{"wel.example.com."}, Latitude: -41.29, Longitude: 174.78},
+		{Name: "wel-hr.example.com.", IP: net.ParseIP("10.1.2.4"), Model: "Q330HR", Code: "WEL", Place: "Wellington Office", Latitude: -41.29, Longitude: 174.78},
+		{Name: "akl-gw.example.com.", IP: net.ParseIP("10.2.2.3"), Model: "Q330", Code: "AKL", Place: "Auckland", Latitude: -36.85, Longitude: 174.76},
+		{Name: "chc-gw.example.com.", IP: net.ParseIP("10.3.2.3"), Model: "Cusp", Code: "CHC", Place: "Christchurch"},
+	}}
+}
+
+func TestFilter(t *testing.T) {
+	d := testDevices()
+
+	names := func(l *Devices) []string {
+		var res []string
+		for _, s := range l.List {
+			res = append(res, s.Hostname())
+		}
+		return res
+	}
+
+	_, network, _ := net.ParseCIDR("10.1.0.0/16")
+	if n := names(d.Filter(And(ByModelRegex(regexp.MustCompile("^Q330")), Not(InNetwork(*network))))); len(n) != 1 || n[0] != "akl-gw" {
+		t.Errorf("Filter: %v", n)
+	}
+	if n := names(d.Filter(Or(HasAlias("wel.example.com"), ByCode("chc")))); len(n) != 2 || n[0] != "wel-gw" || n[1] != "chc-gw" {
+		t.Errorf("Filter: %v", n)
+	}
+	if n := names(d.Filter(WithinRadius(-41.3, 174.8, 50.0))); len(n) != 2 {
+		t.Errorf("Filter: %v", n)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	d := testDevices()
+
+	var tests = []struct {
+		query string
+		count int
+	}{
+		{``, 4},
+		{`model~"Q330.*" and code=WEL and net=10.1.0.0/16`, 2},
+		{`model=Q330 and not code=wel`, 1},
+		{`model!=Q330`, 2},
+		{`code=AKL or (place~"^Well" and name!~hr)`, 2},
+		{`place="Wellington Office"`, 2},
+		{`alias=wel.example.com`, 1},
+		{`ip=10.3.2.3`, 1},
+		{`within=-41.3,174.8,50`, 2},
+		{`NOT (model~Q330) OR code=AKL`, 2},
+	}
+
+	for _, x := range tests {
+		l, err := d.Query(x.query)
+		if err != nil {
+			t.Errorf("Query %q: %v", x.query, err)
+			continue
+		}
+		if len(l.List) != x.count {
+			t.Errorf("Query %q: expected %d devices, found %d", x.query, x.count, len(l.List))
+		}
+	}
+
+	for _, q := range []string{
+		`model`,
+		`model=`,
+		`model=Q330 and`,
+		`(model=Q330`,
+		`model=Q330)`,
+		`colour=red`,
+		`net~10.0.0.0/8`,
+		`net=10.0.0.0`,
+		`place="Wellington`,
+		`model~"("`,
+		`within=1,2`,
+	} {
+		if _, err := ParseQuery(q); err == nil {
+			t.Errorf("ParseQuery %q: expected an error", q)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package zone
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	EARTH_RADIUS = 6371.0 // mean earth radius in km
+)
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180.0
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180.0 / math.Pi
+}
+
+// HasLocation indicates whether the device has a known location, devices
+// without LOC records will be placed at the origin.
+func (d *Device) HasLocation() bool {
+	return d.Latitude != 0.0 || d.Longitude != 0.0 || d.Height != 0.0
+}
+
+// DistanceTo returns the great circle distance in km from the device to the given point (haversine).
+func (d *Device) DistanceTo(lat, lon float64) float64 {
+	p1, p2 := radians(d.Latitude), radians(lat)
+	dp, dl := radians(lat-d.Latitude), radians(lon-d.Longitude)
+
+	a := math.Sin(dp/2)*math.Sin(dp/2) + math.Cos(p1)*math.Cos(p2)*math.Sin(dl/2)*math.Sin(dl/2)
+
+	return EARTH_RADIUS * 2.0 * math.Atan2(math.Sqrt(a), math.Sqrt(1.0-a))
+}
+
+// BearingTo returns the initial great circle bearing in degrees, clockwise from north, from the device to the given point.
+func (d *Device) BearingTo(lat, lon float64) float64 {
+	p1, p2 := radians(d.Latitude), radians(lat)
+	dl := radians(lon - d.Longitude)
+
+	y := math.Sin(dl) * math.Cos(p2)
+	x := math.Cos(p1)*math.Sin(p2) - math.Sin(p1)*math.Cos(p2)*math.Cos(dl)
+
+	return math.Mod(degrees(math.Atan2(y, x))+360.0, 360.0)
+}
+
+// ListWithinRadius returns the devices within the given distance (km) of a point.
+func (d *Devices) ListWithinRadius(lat, lon, km float64) *Devices {
+	l := Devices{}
+
+	for _, s := range d.List {
+		if !s.HasLocation() {
+			continue
+		}
+		if s.DistanceTo(lat, lon) > km {
+			continue
+		}
+		l.List = append(l.List, s)
+	}
+
+	return &l
+}
+
+// Nearest returns up to n devices closest to a point, in order of distance.
+func (d *Devices) Nearest(lat, lon float64, n int) *Devices {
+	l := Devices{}
+
+	for _, s := range d.List {
+		if !s.HasLocation() {
+			continue
+		}
+		l.List = append(l.List, s)
+	}
+
+	sort.SliceStable(l.List, func(i, j int) bool {
+		return l.List[i].DistanceTo(lat, lon) < l.List[j].DistanceTo(lat, lon)
+	})
+
+	if n >= 0 && len(l.List) > n {
+		l.List = l.List[:n]
+	}
+
+	return &l
+}
+
+// ListInBox returns the devices within a latitude/longitude bounding box, boxes
+// crossing the antimeridian can be given with minLon greater than maxLon.
+func (d *Devices) ListInBox(minLat, minLon, maxLat, maxLon float64) *Devices {
+	l := Devices{}
+
+	for _, s := range d.List {
+		if !s.HasLocation() {
+			continue
+		}
+		if s.Latitude < minLat || s.Latitude > maxLat {
+			continue
+		}
+		switch {
+		case minLon <= maxLon && (s.Longitude < minLon || s.Longitude > maxLon):
+			continue
+		case minLon > maxLon && (s.Longitude < minLon && s.Longitude > maxLon):
+			continue
+		}
+		l.List = append(l.List, s)
+	}
+
+	return &l
+}
+
+// ListInPolygon returns the devices found within any of the given polygons.
+func (d *Devices) ListInPolygon(polygons ...*Polygon) *Devices {
+	l := Devices{}
+
+	for _, s := range d.List {
+		if !s.HasLocation() {
+			continue
+		}
+		for _, p := range polygons {
+			if !p.Contains(s.Latitude, s.Longitude) {
+				continue
+			}
+			l.List = append(l.List, s)
+			break
+		}
+	}
+
+	return &l
+}
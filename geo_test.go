@@ -0,0 +1,37 @@
+package zone
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistanceTo(t *testing.T) {
+
+	d := Device{Latitude: -41.2865, Longitude: 174.7762}
+
+	if km := d.DistanceTo(-36.8485, 174.7633); math.Abs(km-493.4) > 1.0 {
+		t.Errorf("DistanceTo: %g", km)
+	}
+	if b := d.BearingTo(-36.8485, 174.7633); math.Abs(b-359.8) > 0.5 {
+		t.Errorf("BearingTo: %g", b)
+	}
+}
+
+func TestNearest(t *testing.T) {
+
+	d := Devices{List: []*Device{
+		{Name: "auckland", Latitude: -36.8485, Longitude: 174.7633},
+		{Name: "nowhere"},
+		{Name: "lower-hutt", Latitude: -41.2092, Longitude: 174.9081},
+		{Name: "wellington", Latitude: -41.2865, Longitude: 174.7762},
+	}}
+
+	n := d.Nearest(-41.2865, 174.7762, 2)
+	if len(n.List) != 2 || n.List[0].Name != "wellington" || n.List[1].Name != "lower-hutt" {
+		t.Error("Nearest")
+	}
+
+	if r := d.ListWithinRadius(-41.2865, 174.7762, 20.0); len(r.List) != 2 {
+		t.Error("ListWithinRadius")
+	}
+}
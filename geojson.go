@@ -0,0 +1,116 @@
+package zone
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// the GeoJSON (RFC 7946) structures used for devices and polygons
+type geoJSONGeometry struct {
+	Type        string            `json:"type"`
+	Coordinates json.RawMessage   `json:"coordinates,omitempty"`
+	Geometries  []geoJSONGeometry `json:"geometries,omitempty"`
+}
+
+type geoJSONFeature struct {
+	Type       string           `json:"type"`
+	Geometry   *geoJSONGeometry `json:"geometry"`
+	Properties json.RawMessage  `json:"properties"`
+}
+
+type geoJSONObject struct {
+	geoJSONGeometry
+	Geometry   *geoJSONGeometry `json:"geometry,omitempty"`
+	Properties json.RawMessage  `json:"properties,omitempty"`
+	Features   []geoJSONFeature `json:"features,omitempty"`
+}
+
+type geoJSONCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+// WriteGeoJSON encodes the devices as a GeoJSON FeatureCollection, each device is a Point feature
+// (longitude, latitude, height) with the device details as properties. Devices without a location
+// have no geometry.
+func (d *Devices) WriteGeoJSON(w io.Writer) error {
+	c := geoJSONCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+
+	for _, s := range d.List {
+		p, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+
+		f := geoJSONFeature{Type: "Feature", Properties: p}
+		if s.HasLocation() {
+			g, err := json.Marshal([]float64{s.Longitude, s.Latitude, s.Height})
+			if err != nil {
+				return err
+			}
+			f.Geometry = &geoJSONGeometry{Type: "Point", Coordinates: g}
+		}
+
+		c.Features = append(c.Features, f)
+	}
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+
+	return err
+}
+
+// ReadGeoJSON decodes devices from a GeoJSON FeatureCollection as written by WriteGeoJSON, the
+// device location is taken from the Point geometry if present.
+func ReadGeoJSON(r io.Reader) (*Devices, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var c geoJSONObject
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Type != "FeatureCollection" {
+		return nil, errors.New(fmt.Sprintf("unsupported geojson type %s", c.Type))
+	}
+
+	d := Devices{}
+	for _, f := range c.Features {
+		var s Device
+		if len(f.Properties) > 0 {
+			if err := json.Unmarshal(f.Properties, &s); err != nil {
+				return nil, err
+			}
+		}
+		if s.Name == "" {
+			return nil, errors.New("geojson feature without a device name")
+		}
+
+		if g := f.Geometry; g != nil && g.Type == "Point" {
+			var p []float64
+			if err := json.Unmarshal(g.Coordinates, &p); err != nil {
+				return nil, err
+			}
+			if len(p) < 2 {
+				return nil, errors.New(fmt.Sprintf("invalid point for %s", s.Name))
+			}
+			s.Longitude, s.Latitude = p[0], p[1]
+			if len(p) > 2 {
+				s.Height = p[2]
+			}
+		}
+
+		d.List = append(d.List, &s)
+	}
+
+	return &d, nil
+}
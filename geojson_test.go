@@ -0,0 +1,46 @@
+package zone
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestGeoJSON(t *testing.T) {
+
+	d := Devices{List: []*Device{
+		{
+			Name:      "wel-gw.example.com.",
+			IP:        net.ParseIP("10.1.2.3"),
+			Reverse:   []net.IP{net.ParseIP("10.1.2.3")},
+			Mapping:   map[string]net.IP{"wel-map.example.com.": net.ParseIP("10.1.2.4")},
+			Aliases:   []string{"wel.example.com."},
+			Place:     "Wellington",
+			Model:     "Q330",
+			Code:      "WEL",
+			Latitude:  -41.2865,
+			Longitude: 174.7762,
+			Height:    21,
+		},
+		{Name: "nowhere.example.com."},
+	}}
+
+	var b bytes.Buffer
+	if err := d.WriteGeoJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ReadGeoJSON(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.List) != len(d.List) {
+		t.Fatal("ReadGeoJSON")
+	}
+	for i := range d.List {
+		if d.List[i].String() != r.List[i].String() {
+			t.Errorf("ReadGeoJSON: %s != %s", d.List[i], r.List[i])
+		}
+	}
+}
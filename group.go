@@ -0,0 +1,140 @@
+package zone
+
+import (
+	"sort"
+)
+
+// Group holds the devices sharing a place, code or model.
+type Group struct {
+	Key     string
+	Devices *Devices
+}
+
+// Groups is a list of device groups ordered by key.
+type Groups []Group
+
+// Keys returns the group keys in order.
+func (g Groups) Keys() []string {
+	var keys []string
+	for _, x := range g {
+		keys = append(keys, x.Key)
+	}
+	return keys
+}
+
+// Get returns the devices for a group key, or nil if there is no such group.
+func (g Groups) Get(key string) *Devices {
+	i := sort.Search(len(g), func(i int) bool { return !(g[i].Key < key) })
+	if i < len(g) && g[i].Key == key {
+		return g[i].Devices
+	}
+	return nil
+}
+
+// build groups keyed by a device field, devices keep their list order within a group
+func (d *Devices) groupBy(key func(*Device) string) Groups {
+	groups := make(map[string]*Devices)
+
+	for _, s := range d.List {
+		k := key(s)
+		g, ok := groups[k]
+		if !ok {
+			g = &Devices{}
+			groups[k] = g
+		}
+		g.List = append(g.List, s)
+	}
+
+	var keys []string
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := make(Groups, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, Group{Key: k, Devices: groups[k]})
+	}
+
+	return res
+}
+
+// GroupByPlace groups the devices by place, devices without a place have an empty key.
+func (d *Devices) GroupByPlace() Groups {
+	return d.groupBy(func(s *Device) string { return s.Place })
+}
+
+// GroupByCode groups the devices by site code, devices without a code have an empty key.
+func (d *Devices) GroupByCode() Groups {
+	return d.groupBy(func(s *Device) string { return s.Code })
+}
+
+// GroupByModel groups the devices by model, devices without a model have an empty key.
+func (d *Devices) GroupByModel() Groups {
+	return d.groupBy(func(s *Device) string { return s.Model })
+}
+
+// Summary provides device counts, devices missing a LOC record have no location, those missing a
+// HINFO record have no model or code, and those missing a TXT record have no place.
+type Summary struct {
+	Devices int            `json:"devices"`
+	Models  map[string]int `json:"models"`
+	Codes   map[string]int `json:"codes"`
+	Places  map[string]int `json:"places"`
+
+	MissingLOC   int `json:"missing_loc"`
+	MissingHINFO int `json:"missing_hinfo"`
+	MissingTXT   int `json:"missing_txt"`
+
+	// places where none of the devices have a location
+	Unlocated []string `json:"unlocated"`
+
+	Aliases  int `json:"aliases"`
+	Mappings int `json:"mappings"`
+}
+
+// Summary counts the devices per model, code and place, as well as any missing details.
+func (d *Devices) Summary() *Summary {
+	s := Summary{
+		Devices: len(d.List),
+		Models:  make(map[string]int),
+		Codes:   make(map[string]int),
+		Places:  make(map[string]int),
+	}
+
+	located := make(map[string]bool)
+	for _, x := range d.List {
+		if x.Model != "" {
+			s.Models[x.Model]++
+		}
+		if x.Code != "" {
+			s.Codes[x.Code]++
+		}
+		if x.Place != "" {
+			s.Places[x.Place]++
+			located[x.Place] = located[x.Place] || x.HasLocation()
+		}
+
+		if !x.HasLocation() {
+			s.MissingLOC++
+		}
+		if x.Model == "" && x.Code == "" {
+			s.MissingHINFO++
+		}
+		if x.Place == "" {
+			s.MissingTXT++
+		}
+
+		s.Aliases += len(x.Aliases)
+		s.Mappings += len(x.Mapping)
+	}
+
+	for p, ok := range located {
+		if !ok {
+			s.Unlocated = append(s.Unlocated, p)
+		}
+	}
+	sort.Strings(s.Unlocated)
+
+	return &s
+}
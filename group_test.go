@@ -0,0 +1,47 @@
+package zone
+
+import (
+	"net"
+	"testing"
+)
+
+func TestGroupBy(t *testing.T) {
+	d := testDevices()
+
+	g := d.GroupByCode()
+	if k := g.Keys(); len(k) != 3 || k[0] != "AKL" || k[1] != "CHC" || k[2] != "WEL" {
+		t.Errorf("GroupByCode: keys %v", k)
+	}
+	if l := g.Get("WEL"); l == nil || len(l.List) != 2 || l.List[0].Hostname() != "wel-gw" {
+		t.Errorf("GroupByCode: WEL %v", l)
+	}
+	if g.Get("XXX") != nil {
+		t.Error("GroupByCode: unexpected group")
+	}
+
+	if k := d.GroupByModel().Keys(); len(k) != 3 || k[0] != "Cusp" {
+		t.Errorf("GroupByModel: keys %v", k)
+	}
+	if l := d.GroupByPlace().Get("Wellington Office"); l == nil || len(l.List) != 2 {
+		t.Errorf("GroupByPlace: %v", l)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	d := testDevices()
+	d.List = append(d.List, &Device{Name: "spare.example.com.", IP: net.ParseIP("10.4.2.3"), Mapping: map[string]net.IP{"spare-map.example.com.": net.ParseIP("10.4.9.9")}})
+
+	s := d.Summary()
+	switch {
+	case s.Devices != 5:
+		t.Errorf("Summary: devices %d", s.Devices)
+	case s.Models["Q330"] != 2 || s.Codes["WEL"] != 2 || s.Places["Christchurch"] != 1:
+		t.Errorf("Summary: counts %v %v %v", s.Models, s.Codes, s.Places)
+	case s.MissingLOC != 2 || s.MissingHINFO != 1 || s.MissingTXT != 1:
+		t.Errorf("Summary: missing %d %d %d", s.MissingLOC, s.MissingHINFO, s.MissingTXT)
+	case len(s.Unlocated) != 1 || s.Unlocated[0] != "Christchurch":
+		t.Errorf("Summary: unlocated %v", s.Unlocated)
+	case s.Aliases != 1 || s.Mappings != 1:
+		t.Errorf("Summary: aliases %d mappings %d", s.Aliases, s.Mappings)
+	}
+}
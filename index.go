@@ -0,0 +1,280 @@
+package zone
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// IndexedDevices is a read-only snapshot of a set of devices, indexed by their lower-cased
+// names, aliases, addresses, codes, models and places, for constant time lookups. The lookups
+// give the same results as the matching Devices methods. The snapshot holds its own copy of
+// the devices, so later changes to the original set aren't seen, and the devices it returns
+// must not be modified.
+type IndexedDevices struct {
+	list []*Device
+
+	names     map[string][]int
+	aliases   map[string][]int
+	ips       map[string][]int // A and AAAA addresses
+	addresses map[string][]int // reverse and mapping addresses
+	codes     map[string][]int
+	models    map[string][]int
+	places    map[string][]int
+}
+
+func indexKey(s string) string {
+	return strings.ToLower(s)
+}
+
+func indexIP(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// copy a device, including its lists and mappings
+func copyDevice(d *Device) *Device {
+	c := *d
+
+	if d.IP != nil {
+		c.IP = CopyIP(d.IP)
+	}
+	if d.IP6 != nil {
+		c.IP6 = CopyIP(d.IP6)
+	}
+	c.Aliases = append([]string(nil), d.Aliases...)
+	c.Reverse = nil
+	for _, r := range d.Reverse {
+		c.Reverse = append(c.Reverse, CopyIP(r))
+	}
+	if d.Mapping != nil {
+		c.Mapping = make(map[string]net.IP)
+		for n, ip := range d.Mapping {
+			c.Mapping[n] = CopyIP(ip)
+		}
+	}
+
+	return &c
+}
+
+// NewIndexedDevices builds an indexed snapshot of the devices.
+func NewIndexedDevices(devices *Devices) *IndexedDevices {
+	x := IndexedDevices{
+		names:     make(map[string][]int),
+		aliases:   make(map[string][]int),
+		ips:       make(map[string][]int),
+		addresses: make(map[string][]int),
+		codes:     make(map[string][]int),
+		models:    make(map[string][]int),
+		places:    make(map[string][]int),
+	}
+
+	add := func(m map[string][]int, k string, i int) {
+		if l := m[k]; len(l) > 0 && l[len(l)-1] == i {
+			return
+		}
+		m[k] = append(m[k], i)
+	}
+
+	for i, s := range devices.List {
+		d := copyDevice(s)
+		x.list = append(x.list, d)
+
+		add(x.names, indexKey(d.Name), i)
+		for _, a := range d.Aliases {
+			add(x.aliases, indexKey(a), i)
+		}
+		if d.IP != nil {
+			add(x.ips, indexIP(d.IP), i)
+		}
+		if d.IP6 != nil {
+			add(x.ips, indexIP(d.IP6), i)
+		}
+		for _, r := range d.Reverse {
+			add(x.addresses, indexIP(r), i)
+		}
+		for _, m := range d.Mapping {
+			add(x.addresses, indexIP(m), i)
+		}
+		add(x.codes, indexKey(d.Code), i)
+		add(x.models, indexKey(d.Model), i)
+		add(x.places, indexKey(d.Place), i)
+	}
+
+	return &x
+}
+
+// LoadLocalIndexed loads the devices from the given zones, as per LoadLocal, and indexes them.
+func LoadLocalIndexed(server string, zones, reverse []string) (*IndexedDevices, error) {
+	return LoadLocalIndexedContext(context.Background(), server, zones, reverse)
+}
+
+func LoadLocalIndexedContext(ctx context.Context, server string, zones, reverse []string) (*IndexedDevices, error) {
+	d, err := LoadLocalContext(ctx, server, zones, reverse)
+	if err != nil {
+		return nil, err
+	}
+	return NewIndexedDevices(d), nil
+}
+
+// LoadRemoteIndexed loads the devices from a remote server, as per LoadRemote, and indexes them.
+func LoadRemoteIndexed(server string) (*IndexedDevices, error) {
+	return LoadRemoteIndexedContext(context.Background(), server)
+}
+
+func LoadRemoteIndexedContext(ctx context.Context, server string) (*IndexedDevices, error) {
+	d, err := LoadRemoteContext(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	return NewIndexedDevices(d), nil
+}
+
+// the indexed devices for a key that also pass the check, in list order
+func (x *IndexedDevices) lookup(m map[string][]int, k string, check func(*Device) bool) []*Device {
+	var res []*Device
+	for _, i := range m[k] {
+		if s := x.list[i]; check(s) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// the first indexed device for a key that passes the check
+func (x *IndexedDevices) first(m map[string][]int, k string, check func(*Device) bool) *Device {
+	for _, i := range m[k] {
+		if s := x.list[i]; check(s) {
+			return s
+		}
+	}
+	return nil
+}
+
+// Devices returns the devices held in the snapshot.
+func (x *IndexedDevices) Devices() *Devices {
+	return &Devices{List: append([]*Device(nil), x.list...)}
+}
+
+func (x *IndexedDevices) Find(name string) *Device {
+	return x.first(x.names, indexKey(name), func(s *Device) bool {
+		return s.Name == name
+	})
+}
+
+func (x *IndexedDevices) FindByIP(ip net.IP) *Device {
+	return x.first(x.ips, indexIP(ip), func(s *Device) bool {
+		return s.IP.Equal(ip) || (len(s.IP6) > 0 && s.IP6.Equal(ip))
+	})
+}
+
+func (x *IndexedDevices) FindByAlias(alias string) *Device {
+	return x.first(x.aliases, indexKey(alias), func(s *Device) bool {
+		for _, a := range s.Aliases {
+			if strings.EqualFold(a, alias) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (x *IndexedDevices) FindByAddress(ip net.IP) *Device {
+	if s := x.FindByIP(ip); s != nil {
+		return s
+	}
+	return x.first(x.addresses, indexIP(ip), func(s *Device) bool {
+		return s.HasReverse(ip) || s.HasIP(ip)
+	})
+}
+
+func (x *IndexedDevices) ListByModel(model string) *Devices {
+	return &Devices{List: x.lookup(x.models, indexKey(model), func(s *Device) bool {
+		return s.HasModel(model)
+	})}
+}
+
+func (x *IndexedDevices) ListByCode(code string) *Devices {
+	return &Devices{List: x.lookup(x.codes, indexKey(code), func(s *Device) bool {
+		return s.HasCode(code)
+	})}
+}
+
+func (x *IndexedDevices) ListByPlace(place string) *Devices {
+	return &Devices{List: x.lookup(x.places, indexKey(place), func(s *Device) bool {
+		return s.AtPlace(place)
+	})}
+}
+
+func (x *IndexedDevices) ListByModelAndCode(model, code string) *Devices {
+	return &Devices{List: x.lookup(x.models, indexKey(model), func(s *Device) bool {
+		return s.HasModel(model) && s.HasCode(code)
+	})}
+}
+
+// the devices in list order that pass the check, for fields that aren't indexed
+func (x *IndexedDevices) scan(check func(*Device) bool) *Devices {
+	l := Devices{}
+	for _, s := range x.list {
+		if check(s) {
+			l.List = append(l.List, s)
+		}
+	}
+	return &l
+}
+
+func (x *IndexedDevices) ListByNetwork(network net.IPNet) *Devices {
+	return x.scan(func(s *Device) bool {
+		return s.InNetwork(network)
+	})
+}
+
+// the devices in list order with a field matching the expression
+func (x *IndexedDevices) match(re *regexp.Regexp, field func(*Device) string) *Devices {
+	return x.scan(func(s *Device) bool {
+		return re.MatchString(field(s))
+	})
+}
+
+func deviceName(s *Device) string  { return s.Name }
+func deviceModel(s *Device) string { return s.Model }
+func devicePlace(s *Device) string { return s.Place }
+
+func (x *IndexedDevices) MatchByName(name string) (*Devices, error) {
+	re, err := regexp.Compile(name)
+	if err != nil {
+		return nil, err
+	}
+	return x.match(re, deviceName), nil
+}
+
+func (x *IndexedDevices) MustMatchByName(name string) *Devices {
+	return x.match(regexp.MustCompile(name), deviceName)
+}
+
+func (x *IndexedDevices) MatchByModel(model string) (*Devices, error) {
+	re, err := regexp.Compile(model)
+	if err != nil {
+		return nil, err
+	}
+	return x.match(re, deviceModel), nil
+}
+
+func (x *IndexedDevices) MustMatchByModel(model string) *Devices {
+	return x.match(regexp.MustCompile(model), deviceModel)
+}
+
+func (x *IndexedDevices) MatchByPlace(place string) (*Devices, error) {
+	re, err := regexp.Compile(place)
+	if err != nil {
+		return nil, err
+	}
+	return x.match(re, devicePlace), nil
+}
+
+func (x *IndexedDevices) MustMatchByPlace(place string) *Devices {
+	return x.match(regexp.MustCompile(place), devicePlace)
+}
@@ -0,0 +1,96 @@
+package zone
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIndexedDevices(t *testing.T) {
+	plain := testDevices()
+	plain.List[2].Reverse = []net.IP{net.ParseIP("10.2.2.3")}
+	plain.List[3].Mapping = map[string]net.IP{"chc-map.example.com.": net.ParseIP("10.3.9.9")}
+	plain.List[3].IP6 = net.ParseIP("2001:db8::3")
+
+	indexed := NewIndexedDevices(plain)
+
+	name := func(d *Device) string {
+		if d == nil {
+			return ""
+		}
+		return d.Name
+	}
+
+	for _, n := range []string{"wel-gw.example.com.", "WEL-GW.example.com.", "missing.example.com."} {
+		if name(indexed.Find(n)) != name(plain.Find(n)) {
+			t.Errorf("Find: %s", n)
+		}
+	}
+	for _, a := range []string{"10.1.2.4", "2001:db8::3", "10.3.9.9", "10.9.9.9"} {
+		if name(indexed.FindByIP(net.ParseIP(a))) != name(plain.FindByIP(net.ParseIP(a))) {
+			t.Errorf("FindByIP: %s", a)
+		}
+		if name(indexed.FindByAddress(net.ParseIP(a))) != name(plain.FindByAddress(net.ParseIP(a))) {
+			t.Errorf("FindByAddress: %s", a)
+		}
+	}
+	for _, a := range []string{"wel.example.com.", "WEL.example.com.", "missing.example.com."} {
+		if name(indexed.FindByAlias(a)) != name(plain.FindByAlias(a)) {
+			t.Errorf("FindByAlias: %s", a)
+		}
+	}
+	for _, k := range []string{"Q330", "q330", "WEL", "wel", "Wellington Office", "wellington office"} {
+		if len(indexed.ListByModel(k).List) != len(plain.ListByModel(k).List) {
+			t.Errorf("ListByModel: %s", k)
+		}
+		if len(indexed.ListByCode(k).List) != len(plain.ListByCode(k).List) {
+			t.Errorf("ListByCode: %s", k)
+		}
+		if len(indexed.ListByPlace(k).List) != len(plain.ListByPlace(k).List) {
+			t.Errorf("ListByPlace: %s", k)
+		}
+	}
+	if l := indexed.ListByModelAndCode("Q330", "wel").List; len(l) != 1 || l[0].Hostname() != "wel-gw" {
+		t.Errorf("ListByModelAndCode: %v", l)
+	}
+	for _, c := range []string{"10.1.0.0/16", "10.0.0.0/8", "2001:db8::/32", "192.168.0.0/16"} {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(indexed.ListByNetwork(*n).List) != len(plain.ListByNetwork(*n).List) {
+			t.Errorf("ListByNetwork: %s", c)
+		}
+	}
+	for _, re := range []string{"^wel-", "gw", "Q3", "Office$", "^$"} {
+		if len(indexed.MustMatchByName(re).List) != len(plain.MustMatchByName(re).List) {
+			t.Errorf("MatchByName: %s", re)
+		}
+		if len(indexed.MustMatchByModel(re).List) != len(plain.MustMatchByModel(re).List) {
+			t.Errorf("MatchByModel: %s", re)
+		}
+		if len(indexed.MustMatchByPlace(re).List) != len(plain.MustMatchByPlace(re).List) {
+			t.Errorf("MatchByPlace: %s", re)
+		}
+	}
+	if _, err := indexed.MatchByName("wel-("); err == nil {
+		t.Error("MatchByName: expected an invalid expression error")
+	}
+
+	// the snapshot is unaffected by later changes to the original devices
+	plain.Find("chc-gw.example.com.").Model = "Q330"
+	plain.List[0] = &Device{Name: "new.example.com.", IP: net.ParseIP("10.4.2.3")}
+	if n := len(indexed.ListByModel("Q330").List); n != 2 {
+		t.Errorf("ListByModel: snapshot changed, found %d", n)
+	}
+	if indexed.Find("new.example.com.") != nil || indexed.Find("wel-gw.example.com.") == nil {
+		t.Error("Find: snapshot changed")
+	}
+	if len(indexed.Devices().List) != 4 {
+		t.Error("Devices: snapshot changed")
+	}
+
+	// while the plain devices see the changes
+	if n := len(plain.ListByModel("Q330").List); n != 2 || plain.Find("new.example.com.") == nil {
+		t.Errorf("ListByModel: changes not seen, found %d", n)
+	}
+}
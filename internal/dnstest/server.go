@@ -0,0 +1,570 @@
+// Package dnstest provides an in-process authoritative DNS server for testing, it answers
+// queries, full and incremental zone transfers and TSIG signed dynamic updates for zones
+// loaded from master files.
+package dnstest
+
+import (
+	"errors"
+	"github.com/miekg/dns"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEF_KEY    = "test.key."
+	DEF_SECRET = "c2VjcmV0LXRlc3Qta2V5LXZhbHVl" // base64 "secret-test-key-value"
+)
+
+// Server is an authoritative DNS server listening on a loopback UDP and TCP port.
+type Server struct {
+	Addr   string // the loopback address and port
+	Key    string // the TSIG key name required for updates
+	Secret string // the base64 TSIG secret
+
+	mu      sync.Mutex
+	zones   map[string][]dns.RR
+	journal map[string][]change
+
+	udp *dns.Server
+	tcp *dns.Server
+}
+
+// the records deleted and added by an update, between two zone versions
+type change struct {
+	from, to dns.RR
+	del, add []dns.RR
+}
+
+// find the zone origin from a master file name, e.g. "db.example.com" or "10.in-addr.arpa.zone"
+func origin(path string) string {
+	n := filepath.Base(path)
+	n = strings.TrimPrefix(n, "db.")
+	n = strings.TrimSuffix(n, ".zone")
+	n = strings.TrimSuffix(n, ".db")
+	return dns.Fqdn(n)
+}
+
+// read the records of a master zone file, $INCLUDE directives are allowed
+func readZone(path string) ([]dns.RR, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zp := dns.NewZoneParser(f, origin(path), path)
+	zp.SetIncludeAllowed(true)
+
+	var res []dns.RR
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		res = append(res, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// NewServer starts a server for the given master zone files, the zone origins are taken from
+// the file names. Updates must be signed with the DEF_KEY and DEF_SECRET TSIG key.
+func NewServer(files ...string) (*Server, error) {
+	s := Server{
+		Key:     DEF_KEY,
+		Secret:  DEF_SECRET,
+		zones:   make(map[string][]dns.RR),
+		journal: make(map[string][]change),
+	}
+
+	for _, f := range files {
+		rr, err := readZone(f)
+		if err != nil {
+			return nil, err
+		}
+		s.zones[strings.ToLower(origin(f))] = rr
+	}
+
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// listen on a free loopback port for both udp and tcp
+func (s *Server) start() error {
+	for i := 0; i < 10; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		p, err := net.ListenPacket("udp", l.Addr().String())
+		if err != nil {
+			l.Close()
+			continue
+		}
+
+		secret := map[string]string{s.Key: s.Secret}
+		accept := func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept }
+
+		s.Addr = l.Addr().String()
+		// the default accept function refuses update messages
+		s.tcp = &dns.Server{Listener: l, Handler: s, TsigSecret: secret, MsgAcceptFunc: accept}
+		s.udp = &dns.Server{PacketConn: p, Handler: s, TsigSecret: secret, MsgAcceptFunc: accept}
+
+		for _, x := range []*dns.Server{s.tcp, s.udp} {
+			started := make(chan struct{})
+			x.NotifyStartedFunc = func() { close(started) }
+			go x.ActivateAndServe()
+			<-started
+		}
+
+		return nil
+	}
+
+	return errors.New("unable to find a free loopback port")
+}
+
+// Host returns the server address, without the port.
+func (s *Server) Host() string {
+	h, _, _ := net.SplitHostPort(s.Addr)
+	return h
+}
+
+// Port returns the server port.
+func (s *Server) Port() string {
+	_, p, _ := net.SplitHostPort(s.Addr)
+	return p
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	err := s.udp.Shutdown()
+	if e := s.tcp.Shutdown(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Records returns a copy of the records currently held for a zone.
+func (s *Server) Records(zone string) []dns.RR {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []dns.RR
+	for _, rr := range s.zones[strings.ToLower(dns.Fqdn(zone))] {
+		res = append(res, dns.Copy(rr))
+	}
+	return res
+}
+
+// Serial returns the current serial number of a zone.
+func (s *Server) Serial(zone string) uint32 {
+	for _, rr := range s.Records(zone) {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial
+		}
+	}
+	return 0
+}
+
+// find the closest enclosing zone of a name, must be called with the lock held
+func (s *Server) find(name string) string {
+	name = strings.ToLower(name)
+
+	var zone string
+	for z := range s.zones {
+		if dns.IsSubDomain(z, name) && len(z) > len(zone) {
+			zone = z
+		}
+	}
+	return zone
+}
+
+// the zone soa record, must be called with the lock held
+func (s *Server) soa(zone string) dns.RR {
+	for _, rr := range s.zones[zone] {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			return rr
+		}
+	}
+	return nil
+}
+
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	switch {
+	case len(r.Question) != 1:
+		m.SetRcode(r, dns.RcodeFormatError)
+	case r.Opcode == dns.OpcodeUpdate && r.IsTsig() != nil && w.TsigStatus() != nil:
+		tsigError(w, r, m)
+		return
+	case r.Opcode == dns.OpcodeUpdate:
+		s.update(w, r, m)
+	case r.Opcode != dns.OpcodeQuery:
+		m.SetRcode(r, dns.RcodeNotImplemented)
+	case r.Question[0].Qtype == dns.TypeAXFR:
+		s.transfer(w, r, m)
+	case r.Question[0].Qtype == dns.TypeIXFR:
+		s.incremental(w, r, m)
+	default:
+		s.query(r, m)
+	}
+
+	w.WriteMsg(m)
+}
+
+// answer a zone transfer as a single message
+func (s *Server) transfer(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); !ok {
+		m.SetRcode(r, dns.RcodeRefused)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zone := strings.ToLower(r.Question[0].Name)
+	if s.soa(zone) == nil {
+		m.SetRcode(r, dns.RcodeNotAuth)
+		return
+	}
+
+	m.Answer = s.full(zone)
+}
+
+// the full zone contents, starting and ending with the SOA, must be called with the lock held
+func (s *Server) full(zone string) []dns.RR {
+	soa := s.soa(zone)
+
+	res := []dns.RR{dns.Copy(soa)}
+	for _, rr := range s.zones[zone] {
+		if rr.Header().Rrtype != dns.TypeSOA {
+			res = append(res, dns.Copy(rr))
+		}
+	}
+	return append(res, dns.Copy(soa))
+}
+
+// answer an incremental zone transfer as a single message, as per RFC 1995 an up to date
+// client receives only the SOA, otherwise the journalled changes since the client serial
+// are sent, or the full zone if they aren't all known
+func (s *Server) incremental(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); !ok {
+		m.SetRcode(r, dns.RcodeRefused)
+		return
+	}
+	if len(r.Ns) != 1 {
+		m.SetRcode(r, dns.RcodeFormatError)
+		return
+	}
+	client, ok := r.Ns[0].(*dns.SOA)
+	if !ok {
+		m.SetRcode(r, dns.RcodeFormatError)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zone := strings.ToLower(r.Question[0].Name)
+	soa := s.soa(zone)
+	if soa == nil {
+		m.SetRcode(r, dns.RcodeNotAuth)
+		return
+	}
+
+	if client.Serial >= soa.(*dns.SOA).Serial {
+		m.Answer = []dns.RR{dns.Copy(soa)}
+		return
+	}
+
+	journal := s.journal[zone]
+	for i, c := range journal {
+		if c.from.(*dns.SOA).Serial != client.Serial {
+			continue
+		}
+		m.Answer = []dns.RR{dns.Copy(soa)}
+		for _, c := range journal[i:] {
+			m.Answer = append(m.Answer, dns.Copy(c.from))
+			m.Answer = append(m.Answer, c.del...)
+			m.Answer = append(m.Answer, dns.Copy(c.to))
+			m.Answer = append(m.Answer, c.add...)
+		}
+		m.Answer = append(m.Answer, dns.Copy(soa))
+		return
+	}
+
+	m.Answer = s.full(zone)
+}
+
+// answer a standard query, CNAME records are followed within the zone
+func (s *Server) query(r *dns.Msg, m *dns.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.Question[0]
+
+	zone := s.find(q.Name)
+	if zone == "" {
+		m.SetRcode(r, dns.RcodeRefused)
+		return
+	}
+
+	name := q.Name
+	for i := 0; i < 8; i++ {
+		var cname string
+		for _, rr := range s.zones[zone] {
+			h := rr.Header()
+			if !strings.EqualFold(h.Name, name) {
+				continue
+			}
+			switch {
+			case h.Rrtype == q.Qtype, q.Qtype == dns.TypeANY:
+				m.Answer = append(m.Answer, dns.Copy(rr))
+			case h.Rrtype == dns.TypeCNAME:
+				m.Answer = append(m.Answer, dns.Copy(rr))
+				cname = rr.(*dns.CNAME).Target
+			}
+		}
+		if cname == "" || s.find(cname) != zone {
+			break
+		}
+		name = cname
+	}
+
+	if len(m.Answer) > 0 {
+		return
+	}
+
+	if soa := s.soa(zone); soa != nil {
+		m.Ns = append(m.Ns, dns.Copy(soa))
+	}
+
+	// an empty answer for names that exist, or have names below them
+	for _, rr := range s.zones[zone] {
+		if dns.IsSubDomain(strings.ToLower(q.Name), strings.ToLower(rr.Header().Name)) {
+			return
+		}
+	}
+
+	m.Rcode = dns.RcodeNameError
+}
+
+// check whether a zone holds a name, and optionally a record type
+func used(records []dns.RR, name string, rrtype uint16) bool {
+	for _, rr := range records {
+		h := rr.Header()
+		if !strings.EqualFold(h.Name, name) {
+			continue
+		}
+		if rrtype == dns.TypeANY || h.Rrtype == rrtype {
+			return true
+		}
+	}
+	return false
+}
+
+// check the RFC 2136 update prerequisites, returning the response code
+func prerequisites(records []dns.RR, prereq []dns.RR) int {
+	for _, rr := range prereq {
+		h := rr.Header()
+		switch h.Class {
+		case dns.ClassANY:
+			if !used(records, h.Name, h.Rrtype) {
+				if h.Rrtype == dns.TypeANY {
+					return dns.RcodeNameError
+				}
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if used(records, h.Name, h.Rrtype) {
+				if h.Rrtype == dns.TypeANY {
+					return dns.RcodeYXDomain
+				}
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			var found bool
+			for _, x := range records {
+				if dns.IsDuplicate(x, rr) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return dns.RcodeNXRrset
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	return dns.RcodeSuccess
+}
+
+// apply the RFC 2136 update section, the apex SOA and NS records are never removed
+func apply(zone string, records []dns.RR, updates []dns.RR) ([]dns.RR, bool) {
+	var changed bool
+
+	apex := func(rr dns.RR) bool {
+		h := rr.Header()
+		return strings.EqualFold(h.Name, zone) && (h.Rrtype == dns.TypeSOA || h.Rrtype == dns.TypeNS)
+	}
+
+	for _, u := range updates {
+		h := u.Header()
+
+		switch h.Class {
+		case dns.ClassINET:
+			var found bool
+			for _, x := range records {
+				if dns.IsDuplicate(x, u) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				records = append(records, dns.Copy(u))
+				changed = true
+			}
+		default:
+			var keep []dns.RR
+			for _, x := range records {
+				xh := x.Header()
+				switch {
+				case apex(x), !strings.EqualFold(xh.Name, h.Name):
+				case h.Class == dns.ClassANY && (h.Rrtype == dns.TypeANY || h.Rrtype == xh.Rrtype):
+					changed = true
+					continue
+				case h.Class == dns.ClassNONE && isValue(x, u):
+					changed = true
+					continue
+				}
+				keep = append(keep, x)
+			}
+			records = keep
+		}
+	}
+
+	return records, changed
+}
+
+// check whether a class NONE deletion matches a record value
+func isValue(rr, del dns.RR) bool {
+	x := dns.Copy(del)
+	x.Header().Class = rr.Header().Class
+	return dns.IsDuplicate(rr, x)
+}
+
+// reply to a request that failed TSIG verification, as per RFC 8945 the NOTAUTH response holds
+// an unsigned TSIG record with a BADKEY error for unknown keys, or BADSIG otherwise
+func tsigError(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	t := r.IsTsig()
+
+	rcode := dns.RcodeBadSig
+	if errors.Is(w.TsigStatus(), dns.ErrSecret) || errors.Is(w.TsigStatus(), dns.ErrKeyAlg) {
+		rcode = dns.RcodeBadKey
+	}
+
+	m.SetRcode(r, dns.RcodeNotAuth)
+	m.Extra = append(m.Extra, &dns.TSIG{
+		Hdr:        dns.RR_Header{Name: t.Hdr.Name, Rrtype: dns.TypeTSIG, Class: dns.ClassANY},
+		Algorithm:  t.Algorithm,
+		TimeSigned: t.TimeSigned,
+		Fudge:      t.Fudge,
+		OrigId:     r.Id,
+		Error:      uint16(rcode),
+	})
+
+	// written directly, as the response writer would otherwise sign it
+	b, err := m.Pack()
+	if err != nil {
+		return
+	}
+	w.Write(b)
+}
+
+// process a dynamic update, only TSIG signed updates for known zones are accepted
+func (s *Server) update(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	t := r.IsTsig()
+	switch {
+	case t == nil:
+		m.SetRcode(r, dns.RcodeRefused)
+		return
+	}
+
+	// sign the response
+	defer m.SetTsig(t.Hdr.Name, t.Algorithm, 300, time.Now().Unix())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zone := strings.ToLower(r.Question[0].Name)
+	records, ok := s.zones[zone]
+	if !ok {
+		m.SetRcode(r, dns.RcodeNotAuth)
+		return
+	}
+
+	for _, rr := range append(append([]dns.RR{}, r.Answer...), r.Ns...) {
+		if !dns.IsSubDomain(zone, strings.ToLower(rr.Header().Name)) {
+			m.SetRcode(r, dns.RcodeNotZone)
+			return
+		}
+	}
+
+	if rcode := prerequisites(records, r.Answer); rcode != dns.RcodeSuccess {
+		m.SetRcode(r, rcode)
+		return
+	}
+
+	from := dns.Copy(s.soa(zone))
+
+	current, changed := apply(zone, records, r.Ns)
+	if !changed {
+		return
+	}
+
+	for _, rr := range current {
+		if soa, ok := rr.(*dns.SOA); ok {
+			soa.Serial++
+		}
+	}
+
+	s.journal[zone] = append(s.journal[zone], change{
+		from: from,
+		to:   dns.Copy(s.soa(zone)),
+		del:  missing(records, current),
+		add:  missing(current, records),
+	})
+	s.zones[zone] = current
+}
+
+// copies of the records, other than the SOA, not found in the other list
+func missing(records, other []dns.RR) []dns.RR {
+	var res []dns.RR
+	for _, rr := range records {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			continue
+		}
+		var found bool
+		for _, x := range other {
+			if dns.IsDuplicate(rr, x) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, dns.Copy(rr))
+		}
+	}
+	return res
+}
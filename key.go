@@ -0,0 +1,158 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Key describes a TSIG key as stored in a BIND style key file, e.g.
+//
+//	key "update" {
+//		algorithm hmac-sha256;
+//		secret "c2VjcmV0";
+//	};
+type Key struct {
+	Name      string
+	Algorithm string
+	Secret    string
+}
+
+// supported TSIG algorithms, indexed by their BIND names
+var algorithms = map[string]string{
+	"hmac-md5":                 dns.HmacMD5,
+	"hmac-md5.sig-alg.reg.int": dns.HmacMD5,
+	"hmac-sha1":                dns.HmacSHA1,
+	"hmac-sha224":              dns.HmacSHA224,
+	"hmac-sha256":              dns.HmacSHA256,
+	"hmac-sha384":              dns.HmacSHA384,
+	"hmac-sha512":              dns.HmacSHA512,
+}
+
+// Algorithm returns the TSIG algorithm name matching a BIND style algorithm name.
+func Algorithm(name string) (string, error) {
+	a, ok := algorithms[strings.TrimSuffix(strings.ToLower(name), ".")]
+	if !ok {
+		return "", errors.New(fmt.Sprintf("unsupported tsig algorithm %s", name))
+	}
+	return a, nil
+}
+
+// split a key file into tokens, skipping comments
+func keyTokens(data string) []string {
+	var tokens []string
+
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		case c == '#' || (c == '/' && i+1 < len(data) && data[i+1] == '/'):
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			if n := strings.Index(data[i+2:], "*/"); n >= 0 {
+				i = i + n + 3
+			} else {
+				i = len(data)
+			}
+		case c == '{' || c == '}' || c == ';':
+			tokens = append(tokens, string(c))
+		case c == '"':
+			n := strings.IndexByte(data[i+1:], '"')
+			if n < 0 {
+				n = len(data) - i - 1
+			}
+			tokens = append(tokens, data[i+1:i+1+n])
+			i = i + n + 1
+		default:
+			j := i
+			for j < len(data) && !strings.ContainsRune(" \t\r\n{};\"#", rune(data[j])) {
+				j++
+			}
+			tokens = append(tokens, data[i:j])
+			i = j - 1
+		}
+	}
+
+	return tokens
+}
+
+// ReadKey decodes the first key statement found in a BIND style key file.
+func ReadKey(r io.Reader) (*Key, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	t := keyTokens(string(data))
+	for i := 0; i < len(t); i++ {
+		if t[i] != "key" {
+			continue
+		}
+		if i+2 >= len(t) || t[i+2] != "{" {
+			return nil, errors.New("invalid key statement")
+		}
+
+		k := Key{Name: t[i+1]}
+		for i = i + 3; i < len(t) && t[i] != "}"; i++ {
+			if i+2 >= len(t) || t[i+2] != ";" {
+				return nil, errors.New(fmt.Sprintf("invalid key clause for %s", k.Name))
+			}
+			switch t[i] {
+			case "algorithm":
+				a, err := Algorithm(t[i+1])
+				if err != nil {
+					return nil, err
+				}
+				k.Algorithm = a
+			case "secret":
+				k.Secret = t[i+1]
+			}
+			i = i + 2
+		}
+
+		if k.Algorithm == "" || k.Secret == "" {
+			return nil, errors.New(fmt.Sprintf("incomplete key %s", k.Name))
+		}
+
+		return &k, nil
+	}
+
+	return nil, errors.New("no key found")
+}
+
+// ReadKeyFile decodes the first key statement found in the given BIND style key file.
+func ReadKeyFile(path string) (*Key, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadKey(f)
+}
+
+// NewServiceWithKey builds a Service which signs updates with the given key.
+func NewServiceWithKey(server string, key *Key) *Service {
+	return &Service{
+		Server:    server,
+		Key:       key.Name,
+		Secret:    key.Secret,
+		Algorithm: key.Algorithm,
+		Port:      "53",
+	}
+}
+
+// NewServiceWithKeyFile builds a Service which signs updates with the key found in a BIND style key file.
+func NewServiceWithKeyFile(server, path string) (*Service, error) {
+	k, err := ReadKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewServiceWithKey(server, k), nil
+}
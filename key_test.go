@@ -0,0 +1,33 @@
+package zone
+
+import (
+	"github.com/miekg/dns"
+	"strings"
+	"testing"
+)
+
+func TestReadKey(t *testing.T) {
+
+	k, err := ReadKey(strings.NewReader(`# generated by tsig-keygen
+key "update-key" {
+	algorithm hmac-sha256; // comment
+	secret "c2VjcmV0IGtleQ==";
+};`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if k.Name != "update-key" || k.Algorithm != dns.HmacSHA256 || k.Secret != "c2VjcmV0IGtleQ==" {
+		t.Error("ReadKey")
+	}
+}
+
+func TestAlgorithm(t *testing.T) {
+
+	if a, err := Algorithm("HMAC-SHA512."); err != nil || a != dns.HmacSHA512 {
+		t.Error("Algorithm")
+	}
+	if _, err := Algorithm("hmac-unknown"); err == nil {
+		t.Error("Algorithm")
+	}
+}
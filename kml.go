@@ -0,0 +1,135 @@
+package zone
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// KML folder grouping
+const (
+	KML_BY_PLACE = iota
+	KML_BY_CODE
+	KML_BY_MODEL
+)
+
+const (
+	KML_NAMESPACE = "http://www.opengis.net/kml/2.2"
+	KML_UNKNOWN   = "unknown"
+)
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPlacemark struct {
+	Name        string   `xml:"name"`
+	Description string   `xml:"description"`
+	Point       kmlPoint `xml:"Point"`
+}
+
+type kmlFolder struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlDocument struct {
+	Name    string      `xml:"name"`
+	Folders []kmlFolder `xml:"Folder"`
+}
+
+type kmlRoot struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+// the balloon description of a device
+func kmlDescription(d *Device) string {
+	var l []string
+
+	add := func(k, v string) {
+		if v != "" {
+			l = append(l, fmt.Sprintf("<b>%s:</b> %s", k, v))
+		}
+	}
+
+	add("Name", d.Name)
+	if d.IP != nil {
+		add("IP", d.IP.String())
+	}
+	if d.IP6 != nil {
+		add("IPv6", d.IP6.String())
+	}
+	add("Model", d.Model)
+	add("Code", d.Code)
+	add("Place", d.Place)
+
+	return strings.Join(l, "<br/>")
+}
+
+// WriteKML encodes the devices as a KML document with a Placemark per device, grouped into
+// Folders by place, code or model. Devices without a location are skipped.
+func (d *Devices) WriteKML(w io.Writer, name string, group int) error {
+	folders := make(map[string]*kmlFolder)
+
+	for _, s := range d.List {
+		if !s.HasLocation() {
+			continue
+		}
+
+		var k string
+		switch group {
+		case KML_BY_CODE:
+			k = s.Code
+		case KML_BY_MODEL:
+			k = s.Model
+		default:
+			k = s.Place
+		}
+		if k == "" {
+			k = KML_UNKNOWN
+		}
+
+		f, ok := folders[k]
+		if !ok {
+			f = &kmlFolder{Name: k}
+			folders[k] = f
+		}
+
+		f.Placemarks = append(f.Placemarks, kmlPlacemark{
+			Name:        s.Hostname(),
+			Description: kmlDescription(s),
+			Point: kmlPoint{
+				Coordinates: fmt.Sprintf("%f,%f,%g", s.Longitude, s.Latitude, s.Height),
+			},
+		})
+	}
+
+	var keys []string
+	for k := range folders {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	k := kmlRoot{Xmlns: KML_NAMESPACE, Document: kmlDocument{Name: name}}
+	for _, n := range keys {
+		k.Document.Folders = append(k.Document.Folders, *folders[n])
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(k); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
@@ -0,0 +1,30 @@
+package zone
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteKML(t *testing.T) {
+
+	d := Devices{List: []*Device{
+		{Name: "wel-gw.example.com.", Place: "Wellington", Model: "Q330", Code: "WEL", Latitude: -41.2865, Longitude: 174.7762, Height: 21},
+		{Name: "wel-dl.example.com.", Place: "Wellington", Model: "Q330", Code: "WEL", Latitude: -41.2865, Longitude: 174.7762, Height: 21},
+		{Name: "akl-gw.example.com.", Place: "Auckland", Model: "Q330", Code: "AKL", Latitude: -36.8485, Longitude: 174.7633},
+		{Name: "nowhere.example.com."},
+	}}
+
+	var b bytes.Buffer
+	if err := d.WriteKML(&b, "devices", KML_BY_PLACE); err != nil {
+		t.Fatal(err)
+	}
+
+	k := b.String()
+	if strings.Count(k, "<Folder>") != 2 || strings.Count(k, "<Placemark>") != 3 {
+		t.Error("WriteKML")
+	}
+	if !strings.Contains(k, "<coordinates>174.776200,-41.286500,21</coordinates>") {
+		t.Error("WriteKML: coordinates")
+	}
+}
@@ -0,0 +1,72 @@
+package zone
+
+import (
+	"github.com/miekg/dns"
+	"log/slog"
+)
+
+// Change event types
+const (
+	EVENT_EXTRA_REVERSE   = "extra-reverse"
+	EVENT_MISSING_REVERSE = "missing-reverse"
+	EVENT_EXTRA_ALIAS     = "extra-alias"
+	EVENT_MISSING_ALIAS   = "missing-alias"
+	EVENT_EXTRA_MAPPING   = "extra-mapping"
+	EVENT_MISSING_MAPPING = "missing-mapping"
+	EVENT_INFO            = "info"
+	EVENT_REMOVE_DEVICE   = "remove-device"
+	EVENT_RECORD          = "record"
+)
+
+// Event describes a single planned change, the operation is one of the Plan operations. Device info
+// changes are reported as EVENT_INFO, device removals as EVENT_REMOVE_DEVICE, and changes made via
+// the Service Insert and Remove methods as EVENT_RECORD.
+type Event struct {
+	Type   string
+	Zone   string
+	Op     string
+	Record dns.RR
+}
+
+// Logger receives the change events of a Service.
+type Logger interface {
+	Log(Event)
+}
+
+// LoggerFunc allows an ordinary function to be used as a Logger.
+type LoggerFunc func(Event)
+
+func (f LoggerFunc) Log(e Event) {
+	f(e)
+}
+
+// NopLogger discards all events.
+type NopLogger struct{}
+
+func (NopLogger) Log(Event) {}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger reports events as structured log/slog records.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Log(e Event) {
+	var name, record string
+	if e.Record != nil {
+		name, record = e.Record.Header().Name, e.Record.String()
+	}
+	l.logger.Info("dns change",
+		slog.String("type", e.Type),
+		slog.String("zone", e.Zone),
+		slog.String("op", e.Op),
+		slog.String("name", name),
+		slog.String("record", record),
+	)
+}
@@ -0,0 +1,213 @@
+package zone
+
+import (
+	"context"
+	"github.com/miekg/dns"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEF_NOTIFY_TIMEOUT = time.Minute
+)
+
+// Notifier listens for DNS NOTIFY messages (RFC 1996) for the zones held in a Cache,
+// and refreshes the cache as they arrive. Only messages from the configured masters
+// are accepted, if none are given the cache service address is used. The optional
+// callback is given each new set of devices. Each refresh is bounded by the timeout,
+// so a hung transfer doesn't block later notifications.
+type Notifier struct {
+	Cache    *Cache
+	Addr     string
+	Masters  []net.IP
+	Callback func(*Devices)
+	Timeout  time.Duration // refresh timeout, defaults to DEF_NOTIFY_TIMEOUT
+
+	mu      sync.Mutex
+	server  *dns.Server
+	pending chan struct{}
+	stop    chan struct{}
+}
+
+func NewNotifier(cache *Cache, addr string, callback func(*Devices)) *Notifier {
+	return &Notifier{
+		Cache:    cache,
+		Addr:     addr,
+		Callback: callback,
+	}
+}
+
+// check whether the message source is a known master
+func (n *Notifier) allowed(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		return false
+	}
+
+	masters := n.Masters
+	if !(len(masters) > 0) {
+		h, err := n.Cache.Service.ServerPort()
+		if err != nil {
+			return false
+		}
+		host, _, err := net.SplitHostPort(h)
+		if err != nil {
+			return false
+		}
+		masters = []net.IP{net.ParseIP(host)}
+	}
+
+	for _, m := range masters {
+		if m.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check whether the zone is held in the cache
+func (n *Notifier) known(zone string) bool {
+	for _, z := range append(append([]string{}, n.Cache.Zones...), n.Cache.Reverse...) {
+		if strings.EqualFold(dns.Fqdn(z), dns.Fqdn(zone)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Notifier) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	switch {
+	case r.Opcode != dns.OpcodeNotify:
+		m.SetRcode(r, dns.RcodeNotImplemented)
+	case len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA:
+		m.SetRcode(r, dns.RcodeFormatError)
+	case !n.allowed(w.RemoteAddr()):
+		m.SetRcode(r, dns.RcodeRefused)
+	case !n.known(r.Question[0].Name):
+		m.SetRcode(r, dns.RcodeNotAuth)
+	default:
+		n.trigger()
+	}
+
+	w.WriteMsg(m)
+}
+
+// request a refresh, multiple requests are merged while one is pending
+func (n *Notifier) trigger() {
+	n.mu.Lock()
+	pending := n.pending
+	n.mu.Unlock()
+
+	if pending == nil {
+		return
+	}
+
+	select {
+	case pending <- struct{}{}:
+	default:
+	}
+}
+
+// run refreshes as they are requested until stopped
+func (n *Notifier) run(pending, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-pending:
+			// a stop takes priority over any pending refresh
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			n.refresh(stop)
+		}
+	}
+}
+
+// refresh the cache, giving up after the timeout or when stopped
+func (n *Notifier) refresh(stop chan struct{}) {
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = DEF_NOTIFY_TIMEOUT
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	changed, err := n.Cache.RefreshContext(ctx)
+	if err != nil {
+		log.Printf("unable to refresh devices: %v", err)
+		return
+	}
+	if changed && n.Callback != nil {
+		n.Callback(n.Cache.Devices())
+	}
+}
+
+// ListenAndServe starts listening for NOTIFY messages on the UDP address, blocking until shutdown.
+func (n *Notifier) ListenAndServe() error {
+	pc, err := net.ListenPacket("udp", n.Addr)
+	if err != nil {
+		return err
+	}
+	return n.Serve(pc)
+}
+
+// Serve handles NOTIFY messages arriving on the packet connection, blocking until shutdown.
+func (n *Notifier) Serve(pc net.PacketConn) error {
+	n.mu.Lock()
+	n.pending = make(chan struct{}, 1)
+	n.stop = make(chan struct{})
+	n.server = &dns.Server{PacketConn: pc, Handler: n}
+	server, pending, stop := n.server, n.pending, n.stop
+	n.mu.Unlock()
+
+	go n.run(pending, stop)
+
+	return server.ActivateAndServe()
+}
+
+// Shutdown stops listening for NOTIFY messages.
+func (n *Notifier) Shutdown() error {
+	// the lock isn't held while shutting down, as in-flight handlers may need it
+	n.mu.Lock()
+	server, stop := n.server, n.stop
+	n.server, n.pending, n.stop = nil, nil, nil
+	n.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+
+	close(stop)
+
+	// a server yet to start is stopped by closing its connection instead
+	if err := server.Shutdown(); err != nil {
+		return server.PacketConn.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package zone
+
+import (
+	"github.com/miekg/dns"
+	"net"
+	"testing"
+	"time"
+)
+
+// start a notifier on a loopback port, returning its address
+func testNotifier(t *testing.T, n *Notifier) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go n.Serve(pc)
+	t.Cleanup(func() { n.Shutdown() })
+
+	registered(n)
+
+	return pc.LocalAddr().String()
+}
+
+// wait until the notifier server has been set up, it may not have started yet
+func registered(n *Notifier) {
+	for {
+		n.mu.Lock()
+		ok := n.server != nil
+		n.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// send a NOTIFY message for a zone, returning the response code
+func testNotify(t *testing.T, addr, zone string) int {
+	m := new(dns.Msg)
+	m.SetNotify(zone)
+
+	r, _, err := new(dns.Client).Exchange(m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r.Rcode
+}
+
+func TestNotifier(t *testing.T) {
+	_, s := testService(t)
+
+	updates := make(chan *Devices, 1)
+	cache := NewCache(s, []string{"example.com."}, []string{"10.in-addr.arpa."})
+	addr := testNotifier(t, NewNotifier(cache, "", func(d *Devices) {
+		updates <- d
+	}))
+
+	if rcode := testNotify(t, addr, "example.com."); rcode != dns.RcodeSuccess {
+		t.Fatalf("Notify: unexpected response %s", dns.RcodeToString[rcode])
+	}
+
+	select {
+	case d := <-updates:
+		if d.Find("wel-gw.example.com.") == nil {
+			t.Errorf("Notify: missing device %v", d.List)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify: no refresh callback")
+	}
+
+	if rcode := testNotify(t, addr, "example.org."); rcode != dns.RcodeNotAuth {
+		t.Errorf("Notify: unknown zone response %s", dns.RcodeToString[rcode])
+	}
+
+	other := NewNotifier(cache, "", nil)
+	other.Masters = []net.IP{net.ParseIP("192.0.2.1")}
+	if rcode := testNotify(t, testNotifier(t, other), "example.com."); rcode != dns.RcodeRefused {
+		t.Errorf("Notify: non-master response %s", dns.RcodeToString[rcode])
+	}
+}
+
+func TestNotifierShutdown(t *testing.T) {
+	_, s := testService(t)
+
+	cache := NewCache(s, []string{"example.com."}, []string{"10.in-addr.arpa."})
+
+	// shutting down before the server has started must still stop it
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := NewNotifier(cache, "", nil)
+	done := make(chan error, 1)
+	go func() { done <- n.Serve(pc) }()
+	registered(n)
+	n.Shutdown()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown: server not stopped before starting")
+	}
+
+	// shutting down while notifications are being handled must not deadlock
+	n = NewNotifier(cache, "", nil)
+	addr := testNotifier(t, n)
+	for i := 0; i < 20; i++ {
+		go func() {
+			m := new(dns.Msg)
+			m.SetNotify("example.com.")
+			new(dns.Client).Exchange(m, addr)
+		}()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		n.Shutdown()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown: deadlocked with pending notifications")
+	}
+}
+
+func TestNotifierTimeout(t *testing.T) {
+
+	// a name server that never answers, reporting each query it receives
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	queries := make(chan struct{}, 10)
+	go func() {
+		b := make([]byte, dns.MaxMsgSize)
+		for {
+			if _, _, err := silent.ReadFrom(b); err != nil {
+				return
+			}
+			queries <- struct{}{}
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(silent.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{Server: host, Port: port, ReadTimeout: time.Minute}
+
+	n := NewNotifier(NewCache(s, []string{"example.com."}, nil), "", nil)
+	n.Timeout = 100 * time.Millisecond
+	addr := testNotifier(t, n)
+
+	// a second notification is only acted on once the first refresh has given up
+	for i := 0; i < 2; i++ {
+		if rcode := testNotify(t, addr, "example.com."); rcode != dns.RcodeSuccess {
+			t.Fatalf("Notify: unexpected response %s", dns.RcodeToString[rcode])
+		}
+		select {
+		case <-queries:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Notify: refresh %d not started", i+1)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package zone
+
+import (
+	"github.com/miekg/dns"
+	"sort"
+	"strings"
+)
+
+// Plan operations, updates and RFC 2136 prerequisites
+const (
+	PLAN_INSERT       = "insert"
+	PLAN_REMOVE_RRSET = "remove-rrset"
+	PLAN_REMOVE_NAME  = "remove-name"
+	PLAN_NAME_USED    = "name-used"
+	PLAN_RRSET_USED   = "rrset-used"
+)
+
+// PlanStep describes a single dynamic update change or prerequisite for a zone.
+type PlanStep struct {
+	Zone string
+	Op   string
+	RR   []dns.RR
+}
+
+// Plan collects dynamic update changes and prerequisites, in order, ready to be sent via Service.Send
+// as a single message per zone. A dry run Service records the plans it would have sent.
+type Plan struct {
+	Steps []PlanStep
+}
+
+// Insert adds records to the zone.
+func (p *Plan) Insert(zone string, rr []dns.RR) {
+	p.add(zone, PLAN_INSERT, rr)
+}
+
+// RemoveRRset removes the record sets matching the name and type of the given records.
+func (p *Plan) RemoveRRset(zone string, rr []dns.RR) {
+	p.add(zone, PLAN_REMOVE_RRSET, rr)
+}
+
+// RemoveName removes all records of the given names.
+func (p *Plan) RemoveName(zone string, rr []dns.RR) {
+	p.add(zone, PLAN_REMOVE_NAME, rr)
+}
+
+// NameUsed requires the names to be in use before the zone is updated.
+func (p *Plan) NameUsed(zone string, names ...string) {
+	var rr []dns.RR
+	for _, n := range names {
+		rr = append(rr, &dns.ANY{
+			Hdr: dns.RR_Header{Name: dns.Fqdn(n), Rrtype: dns.TypeANY, Class: dns.ClassINET},
+		})
+	}
+	p.add(zone, PLAN_NAME_USED, rr)
+}
+
+// RRsetUsed requires the record sets to exist with exactly the given values before the zone is updated.
+func (p *Plan) RRsetUsed(zone string, rr []dns.RR) {
+	p.add(zone, PLAN_RRSET_USED, rr)
+}
+
+// SerialUnchanged requires the zone SOA to be unchanged, as found via Service.SOA, before the zone is updated.
+func (p *Plan) SerialUnchanged(soa *dns.SOA) {
+	p.add(soa.Header().Name, PLAN_RRSET_USED, []dns.RR{soa})
+}
+
+// Messages builds the unsigned UPDATE messages for the plan, one per zone in the order first planned.
+func (p *Plan) Messages() []*dns.Msg {
+	var res []*dns.Msg
+
+	msgs := make(map[string]*dns.Msg)
+	for _, x := range p.Steps {
+		m, ok := msgs[x.Zone]
+		if !ok {
+			m = new(dns.Msg)
+			m.SetUpdate(x.Zone)
+			msgs[x.Zone] = m
+			res = append(res, m)
+		}
+		switch x.Op {
+		case PLAN_INSERT:
+			m.Insert(x.RR)
+		case PLAN_REMOVE_RRSET:
+			m.RemoveRRset(x.RR)
+		case PLAN_REMOVE_NAME:
+			m.RemoveName(x.RR)
+		case PLAN_NAME_USED:
+			m.NameUsed(x.RR)
+		case PLAN_RRSET_USED:
+			m.Used(x.RR)
+		}
+	}
+
+	return res
+}
+
+// record an update, OPT pseudo records are not zone changes and are skipped
+func (p *Plan) add(zone, op string, rr []dns.RR) {
+	var l []dns.RR
+	for _, r := range rr {
+		if _, ok := r.(*dns.OPT); ok {
+			continue
+		}
+		l = append(l, dns.Copy(r))
+	}
+	if !(len(l) > 0) {
+		return
+	}
+	p.Steps = append(p.Steps, PlanStep{Zone: dns.Fqdn(zone), Op: op, RR: l})
+}
+
+// Zones returns the sorted names of the zones which would be updated.
+func (p *Plan) Zones() []string {
+	zones := make(map[string]bool)
+	for _, s := range p.Steps {
+		zones[s.Zone] = true
+	}
+
+	var res []string
+	for z := range zones {
+		res = append(res, z)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// ZoneSteps returns the updates which would be sent to a single zone.
+func (p *Plan) ZoneSteps(zone string) []PlanStep {
+	var res []PlanStep
+	for _, s := range p.Steps {
+		if strings.EqualFold(s.Zone, dns.Fqdn(zone)) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// Empty indicates whether no updates would be sent.
+func (p *Plan) Empty() bool {
+	return !(len(p.Steps) > 0)
+}
+
+// String lists the planned updates grouped by zone, one record per line.
+func (p *Plan) String() string {
+	var l []string
+
+	for _, z := range p.Zones() {
+		l = append(l, "zone "+z)
+		for _, s := range p.ZoneSteps(z) {
+			for _, r := range s.RR {
+				l = append(l, "\t"+s.Op+"\t"+r.String())
+			}
+		}
+	}
+
+	if !(len(l) > 0) {
+		return ""
+	}
+
+	return strings.Join(l, "\n") + "\n"
+}
@@ -0,0 +1,104 @@
+package zone
+
+import (
+	"context"
+	"github.com/miekg/dns"
+	"net"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+
+	var events []Event
+	s := Service{Server: "localhost", DryRun: &Plan{}, Logger: LoggerFunc(func(e Event) {
+		events = append(events, e)
+	})}
+
+	from := Device{Name: "wel-gw.example.com.", Aliases: []string{"old.example.com."}}
+	to := Device{Name: "wel-gw.example.com.", Aliases: []string{"new.example.com."}, Reverse: []net.IP{net.ParseIP("10.1.2.3")}}
+
+	if err := s.Update("example.com.", 3600, &from, &to); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateInfo("example.com.", &to); err != nil {
+		t.Fatal(err)
+	}
+
+	if z := s.DryRun.Zones(); len(z) != 2 || z[0] != "10.in-addr.arpa." || z[1] != "example.com." {
+		t.Errorf("DryRun: zones %v", z)
+	}
+	if n := len(s.DryRun.ZoneSteps("example.com.")); n != 4 {
+		t.Errorf("DryRun: expected 4 example.com. steps, found %d", n)
+	}
+	if len(events) != 8 || events[0].Type != EVENT_MISSING_REVERSE || events[0].Zone != "10.in-addr.arpa." {
+		t.Errorf("DryRun: events %v", events)
+	}
+	if e := events[7]; e.Type != EVENT_INFO || e.Op != PLAN_INSERT || e.Zone != "example.com." || e.Record == nil {
+		t.Errorf("DryRun: info event %v", e)
+	}
+}
+
+func TestLoggerEvents(t *testing.T) {
+
+	var events []Event
+	s := Service{Server: "localhost", DryRun: &Plan{}, Logger: LoggerFunc(func(e Event) {
+		events = append(events, e)
+	})}
+
+	d := Device{Name: "wel-gw.example.com.", Place: "Wellington"}
+
+	var tests = []struct {
+		event string
+		op    string
+		count int
+		send  func() error
+	}{
+		{EVENT_INFO, PLAN_INSERT, 3, func() error { return s.UpdateInfo("example.com.", &d) }},
+		{EVENT_INFO, PLAN_REMOVE_RRSET, 3, func() error { return s.RemoveInfo("example.com.", &d) }},
+		{EVENT_INFO, PLAN_REMOVE_RRSET, 2, func() error { return s.ReplaceInfo("example.com.", &d) }},
+		{EVENT_REMOVE_DEVICE, PLAN_REMOVE_NAME, 1, func() error { return s.RemoveAll("example.com.", &d) }},
+		{EVENT_RECORD, PLAN_INSERT, 1, func() error { return s.Insert("example.com.", []dns.RR{d.ToTXT()}) }},
+		{EVENT_RECORD, PLAN_REMOVE_RRSET, 1, func() error { return s.RemoveRRset("example.com.", []dns.RR{d.ToTXT()}) }},
+		{EVENT_RECORD, PLAN_REMOVE_NAME, 1, func() error { return s.RemoveName("example.com.", []dns.RR{d.ToTXT()}) }},
+	}
+
+	for _, x := range tests {
+		events = nil
+		if err := x.send(); err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != x.count {
+			t.Errorf("Logger: %s expected %d events, found %d", x.event, x.count, len(events))
+			continue
+		}
+		if e := events[0]; e.Type != x.event || e.Op != x.op || e.Zone != "example.com." || e.Record == nil {
+			t.Errorf("Logger: unexpected event %v", e)
+		}
+	}
+}
+
+func TestPlanMessages(t *testing.T) {
+
+	s := Service{Server: "localhost", DryRun: &Plan{}}
+
+	from := Device{Name: "wel-gw.example.com.", Aliases: []string{"old.example.com."}}
+	to := Device{Name: "wel-gw.example.com.", Aliases: []string{"new.example.com."}, Reverse: []net.IP{net.ParseIP("10.1.2.3")}}
+
+	p := Plan{}
+	p.SerialUnchanged(NewSOA("example.com.", "ns.example.com.", "hostmaster.example.com.", 5, 3600))
+	p.NameUsed("example.com.", "wel-gw.example.com.")
+	if err := s.PlanUpdateContext(context.Background(), &p, "example.com.", 3600, &from, &to); err != nil {
+		t.Fatal(err)
+	}
+
+	m := p.Messages()
+	if len(m) != 2 {
+		t.Fatalf("Messages: expected 2 messages, found %d", len(m))
+	}
+	if m[0].Question[0].Name != "example.com." || len(m[0].Answer) != 2 || len(m[0].Ns) != 3 {
+		t.Errorf("Messages: %v", m[0])
+	}
+	if m[1].Question[0].Name != "10.in-addr.arpa." || len(m[1].Answer) != 0 || len(m[1].Ns) != 2 {
+		t.Errorf("Messages: %v", m[1])
+	}
+}
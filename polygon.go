@@ -0,0 +1,165 @@
+package zone
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Polygon describes a named region made up of one or more areas, each area is an outer
+// ring followed by any holes. As with GeoJSON, points are given as longitude, latitude pairs.
+type Polygon struct {
+	Name  string
+	Areas [][][][2]float64
+}
+
+// check whether a point is inside a ring, using the even-odd rule
+func inRing(ring [][2]float64, lat, lon float64) bool {
+	var inside bool
+
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// Contains indicates whether the point is within any of the polygon areas.
+func (p *Polygon) Contains(lat, lon float64) bool {
+	for _, a := range p.Areas {
+		if !(len(a) > 0) || !inRing(a[0], lat, lon) {
+			continue
+		}
+		var hole bool
+		for _, h := range a[1:] {
+			if inRing(h, lat, lon) {
+				hole = true
+				break
+			}
+		}
+		if !hole {
+			return true
+		}
+	}
+	return false
+}
+
+// recover the polygon areas of a GeoJSON geometry, other geometry types are ignored
+func (g *geoJSONGeometry) areas() ([][][][2]float64, error) {
+	switch g.Type {
+	case "Polygon":
+		var a [][][2]float64
+		if err := json.Unmarshal(g.Coordinates, &a); err != nil {
+			return nil, err
+		}
+		return [][][][2]float64{a}, nil
+	case "MultiPolygon":
+		var a [][][][2]float64
+		if err := json.Unmarshal(g.Coordinates, &a); err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "GeometryCollection":
+		var res [][][][2]float64
+		for _, c := range g.Geometries {
+			a, err := c.areas()
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, a...)
+		}
+		return res, nil
+	}
+	return nil, nil
+}
+
+// build a polygon from a GeoJSON feature, the name is taken from the "name" property
+func featurePolygon(properties json.RawMessage, geometry *geoJSONGeometry) (*Polygon, error) {
+	if geometry == nil {
+		return nil, nil
+	}
+
+	a, err := geometry.areas()
+	if err != nil {
+		return nil, err
+	}
+	if !(len(a) > 0) {
+		return nil, nil
+	}
+
+	p := Polygon{Areas: a}
+	if len(properties) > 0 {
+		var v struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(properties, &v); err == nil {
+			p.Name = v.Name
+		}
+	}
+
+	return &p, nil
+}
+
+// ReadPolygons decodes the polygons found in a GeoJSON FeatureCollection, Feature or geometry.
+func ReadPolygons(r io.Reader) ([]*Polygon, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var g geoJSONObject
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, err
+	}
+
+	var res []*Polygon
+	add := func(properties json.RawMessage, geometry *geoJSONGeometry) error {
+		p, err := featurePolygon(properties, geometry)
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			res = append(res, p)
+		}
+		return nil
+	}
+
+	switch g.Type {
+	case "FeatureCollection":
+		for _, f := range g.Features {
+			if err := add(f.Properties, f.Geometry); err != nil {
+				return nil, err
+			}
+		}
+	case "Feature":
+		if err := add(g.Properties, g.Geometry); err != nil {
+			return nil, err
+		}
+	case "Polygon", "MultiPolygon", "GeometryCollection":
+		if err := add(nil, &g.geoJSONGeometry); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported geojson type %s", g.Type))
+	}
+
+	return res, nil
+}
+
+// ReadPolygonsFile decodes the polygons found in a GeoJSON file.
+func ReadPolygonsFile(path string) ([]*Polygon, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadPolygons(f)
+}
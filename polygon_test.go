@@ -0,0 +1,43 @@
+package zone
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadPolygons(t *testing.T) {
+
+	p, err := ReadPolygons(strings.NewReader(`{
+  "type": "FeatureCollection",
+  "features": [{
+    "type": "Feature",
+    "properties": {"name": "wellington"},
+    "geometry": {
+      "type": "Polygon",
+      "coordinates": [
+        [[174.6, -41.4], [175.0, -41.4], [175.0, -41.1], [174.6, -41.1], [174.6, -41.4]],
+        [[174.85, -41.25], [174.95, -41.25], [174.95, -41.15], [174.85, -41.15], [174.85, -41.25]]
+      ]
+    }
+  }]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 1 || p[0].Name != "wellington" {
+		t.Fatal("ReadPolygons")
+	}
+
+	d := Devices{List: []*Device{
+		{Name: "auckland", Latitude: -36.8485, Longitude: 174.7633},
+		{Name: "lower-hutt", Latitude: -41.2092, Longitude: 174.9081},
+		{Name: "wellington", Latitude: -41.2865, Longitude: 174.7762},
+	}}
+
+	if l := d.ListInPolygon(p...); len(l.List) != 1 || l.List[0].Name != "wellington" {
+		t.Error("ListInPolygon")
+	}
+	if l := d.ListInBox(-41.4, 174.6, -41.1, 175.0); len(l.List) != 2 {
+		t.Error("ListInBox")
+	}
+}
@@ -0,0 +1,182 @@
+package zone
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DEF_SERVER_ADDR = ":9001"
+	DEF_REFRESH     = 5 * time.Minute
+)
+
+// Server provides the HTTP JSON device listing expected by LoadRemote.
+// The devices are built from the given forward and reverse zones via
+// Service.List, and periodically refreshed. Requests can be filtered by
+// the query parameters "model", "code", "place", "network" (CIDR notation),
+// "name" (a regular expression) and "q" (a query expression, see ParseQuery).
+type Server struct {
+	Service *Service
+	Zones   []string
+	Reverse []string
+	Refresh time.Duration
+
+	mu    sync.RWMutex
+	index *IndexedDevices
+}
+
+func NewServer(service *Service, zones, reverse []string) *Server {
+	return &Server{
+		Service: service,
+		Zones:   zones,
+		Reverse: reverse,
+		Refresh: DEF_REFRESH,
+	}
+}
+
+// Load rebuilds the served devices from DNS.
+func (s *Server) Load() error {
+	l, err := s.Service.List(s.Zones, s.Reverse)
+	if err != nil {
+		return err
+	}
+
+	x := NewIndexedDevices(&Devices{List: l})
+
+	s.mu.Lock()
+	s.index = x
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Index returns the current indexed snapshot of served devices, rebuilt on each load.
+func (s *Server) Index() *IndexedDevices {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.index == nil {
+		return NewIndexedDevices(&Devices{})
+	}
+	return s.index
+}
+
+// Devices returns the current snapshot of served devices.
+func (s *Server) Devices() *Devices {
+	return s.Index().Devices()
+}
+
+// Run reloads the devices every Refresh interval until the stop channel is closed,
+// a failed reload keeps serving the previous devices.
+func (s *Server) Run(stop <-chan struct{}) {
+	refresh := s.Refresh
+	if refresh <= 0 {
+		refresh = DEF_REFRESH
+	}
+
+	t := time.NewTicker(refresh)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if err := s.Load(); err != nil {
+				log.Printf("unable to refresh devices: %v", err)
+			}
+		}
+	}
+}
+
+// filter the devices using the request query parameters
+func (s *Server) filter(r *http.Request) (*Devices, error) {
+	x := s.Index()
+
+	q := r.URL.Query()
+
+	// the model is looked up via the index, the remaining filters narrow the result
+	d := x.Devices()
+	if v := q.Get("model"); v != "" {
+		d = x.ListByModel(v)
+	}
+	if v := q.Get("code"); v != "" {
+		d = d.ListByCode(v)
+	}
+	if v := q.Get("place"); v != "" {
+		d = d.ListByPlace(v)
+	}
+	if v := q.Get("network"); v != "" {
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		d = d.ListByNetwork(*n)
+	}
+	if v := q.Get("name"); v != "" {
+		m, err := d.MatchByName(v)
+		if err != nil {
+			return nil, err
+		}
+		d = m
+	}
+	if v := q.Get("q"); v != "" {
+		m, err := d.Query(v)
+		if err != nil {
+			return nil, err
+		}
+		d = m
+	}
+
+	return d, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	d, err := s.filter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l := d.List
+	if l == nil {
+		l = []*Device{}
+	}
+
+	b, err := json.Marshal(l)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// ListenAndServe loads the devices, starts the refresh loop and serves
+// requests on the given address (or the LoadRemote default port).
+func (s *Server) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = DEF_SERVER_ADDR
+	}
+
+	if err := s.Load(); err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go s.Run(stop)
+
+	return http.ListenAndServe(addr, s)
+}
@@ -0,0 +1,122 @@
+package zone
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// an http server listing the devices held by the test dns server
+func testServer(t *testing.T) *httptest.Server {
+	_, s := testService(t)
+
+	srv := NewServer(s, []string{"example.com."}, []string{"10.in-addr.arpa."})
+	if err := srv.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := httptest.NewServer(srv)
+	t.Cleanup(h.Close)
+
+	return h
+}
+
+func TestServerFilter(t *testing.T) {
+	h := testServer(t)
+
+	var tests = []struct {
+		query  string
+		status int
+		count  int
+	}{
+		{"", http.StatusOK, 2},
+		{"model=Q330", http.StatusOK, 1},
+		{"code=wel", http.StatusOK, 1},
+		{"place=Wellington+Office", http.StatusOK, 1},
+		{"network=10.1.0.0/16", http.StatusOK, 1},
+		{"name=^wel-", http.StatusOK, 1},
+		{"q=" + url.QueryEscape(`model~"Q3" and not code=AKL`), http.StatusOK, 1},
+		{"model=Cusp", http.StatusOK, 0},
+		{"network=10.1.0.0", http.StatusBadRequest, 0},
+		{"name=" + url.QueryEscape("wel-("), http.StatusBadRequest, 0},
+		{"q=" + url.QueryEscape("model="), http.StatusBadRequest, 0},
+	}
+
+	for _, x := range tests {
+		res, err := http.Get(h.URL + "/?" + x.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var l []*Device
+		err = json.NewDecoder(res.Body).Decode(&l)
+		res.Body.Close()
+
+		if res.StatusCode != x.status {
+			t.Errorf("ServeHTTP %q: status %d", x.query, res.StatusCode)
+			continue
+		}
+		if x.status != http.StatusOK {
+			continue
+		}
+		switch {
+		case err != nil:
+			t.Errorf("ServeHTTP %q: %v", x.query, err)
+		case l == nil:
+			t.Errorf("ServeHTTP %q: expected a json list", x.query)
+		case len(l) != x.count:
+			t.Errorf("ServeHTTP %q: expected %d devices, found %d", x.query, x.count, len(l))
+		}
+	}
+
+	res, err := http.Post(h.URL, "application/json", strings.NewReader("[]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("ServeHTTP: POST status %d", res.StatusCode)
+	}
+}
+
+func TestLoadRemote(t *testing.T) {
+	h := testServer(t)
+
+	d, err := LoadRemote(strings.TrimPrefix(h.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := d.Find("wel-gw.example.com.")
+	switch {
+	case len(d.List) != 2:
+		t.Errorf("LoadRemote: expected 2 devices, found %d", len(d.List))
+	case s == nil:
+		t.Error("LoadRemote: missing device")
+	case s.Model != "Q330" || len(s.Aliases) != 2 || len(s.Reverse) != 1 || !s.HasLocation():
+		t.Errorf("LoadRemote: %v", s)
+	}
+}
+
+func TestLoadRemoteIndexed(t *testing.T) {
+	h := testServer(t)
+
+	x, err := LoadRemoteIndexed(strings.TrimPrefix(h.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := x.Find("wel-gw.example.com."); s == nil || s.Model != "Q330" {
+		t.Errorf("LoadRemoteIndexed: Find %v", s)
+	}
+	if s := x.FindByIP(net.ParseIP("10.1.2.3")); s == nil || s.Name != "wel-gw.example.com." {
+		t.Errorf("LoadRemoteIndexed: FindByIP %v", s)
+	}
+	if s := x.FindByAlias("WEL.example.com."); s == nil || s.Name != "wel-gw.example.com." {
+		t.Errorf("LoadRemoteIndexed: FindByAlias %v", s)
+	}
+}
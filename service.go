@@ -1,20 +1,38 @@
 package zone
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/miekg/dns"
 	"net"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	DEF_WORKERS      = 8
+	DEF_READ_TIMEOUT = 2 * time.Second // the dns library default
+)
+
 type Service struct {
-	Server string
-	Key    string
-	Secret string
-	Port   string
+	Server    string
+	Key       string
+	Secret    string
+	Algorithm string // TSIG algorithm, defaults to hmac-md5
+	Port      string
+
+	DialTimeout time.Duration // connection timeout, defaults to the dns library value
+	ReadTimeout time.Duration // response timeout, defaults to the dns library value
+	Workers     int           // concurrent FindMany lookups, defaults to DEF_WORKERS
+
+	DryRun *Plan  // when set, updates are recorded in the plan rather than sent
+	Logger Logger // receives planned update changes, defaults to none
+
+	Resolver *net.Resolver // system lookups of the server address and FindByIP, defaults to net.DefaultResolver
 }
 
 func NewService(server string) *Service {
@@ -24,7 +42,19 @@ func NewService(server string) *Service {
 	}
 }
 
+// the resolver used for system lookups
+func (s *Service) resolver() *net.Resolver {
+	if s.Resolver == nil {
+		return net.DefaultResolver
+	}
+	return s.Resolver
+}
+
 func (s *Service) ServerPort() (string, error) {
+	return s.ServerPortContext(context.Background())
+}
+
+func (s *Service) ServerPortContext(ctx context.Context) (string, error) {
 
 	port := s.Port
 	if port == "" {
@@ -41,7 +71,7 @@ func (s *Service) ServerPort() (string, error) {
 		return "", err
 	}
 
-	h, err := net.LookupHost(n)
+	h, err := s.resolver().LookupHost(ctx, n)
 	if err != nil {
 		return "", err
 	}
@@ -49,52 +79,174 @@ func (s *Service) ServerPort() (string, error) {
 	return net.JoinHostPort(h[0], p), nil
 }
 
-func (s *Service) Transfer(zone string) ([]dns.RR, error) {
-	m := new(dns.Msg)
-	m.SetAxfr(zone)
+// a dns client using the service timeouts
+func (s *Service) client() *dns.Client {
+	return &dns.Client{
+		DialTimeout: s.DialTimeout,
+		ReadTimeout: s.ReadTimeout,
+	}
+}
 
-	h, err := s.ServerPort()
+// the context error, a passed deadline may end a network read before the context is done
+func contextError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// exchange a message, the context error is returned if it ended the exchange
+func exchange(ctx context.Context, c *dns.Client, m *dns.Msg, h string) (*dns.Msg, error) {
+	r, _, err := c.ExchangeContext(ctx, m, h)
+	if err != nil {
+		if e := contextError(ctx); e != nil {
+			return nil, e
+		}
+	}
+	return r, err
+}
+
+// run a zone transfer, the connection is closed if the context is done before it completes
+func (s *Service) transfer(ctx context.Context, m *dns.Msg) ([]dns.RR, error) {
+	h, err := s.ServerPortContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	d := net.Dialer{Timeout: s.DialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", h)
 	if err != nil {
 		return nil, err
 	}
+	defer conn.Close()
+
+	tr := &dns.Transfer{
+		Conn:        &dns.Conn{Conn: conn},
+		ReadTimeout: s.ReadTimeout,
+	}
+
+	done := make(chan struct{})
+	defer close(done)
 
-	tr := new(dns.Transfer)
-	a, err := tr.In(m, h)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	res, err := readTransfer(tr, m, h)
 	if err != nil {
+		if e := contextError(ctx); e != nil {
+			return nil, e
+		}
+	}
+
+	return res, err
+}
+
+// send a zone transfer request and read the response messages, the response code of each
+// message is checked, as per RFC 5936 and RFC 1995 the transfer ends with the repeated
+// current SOA, or the single SOA of an up to date IXFR request
+func readTransfer(tr *dns.Transfer, m *dns.Msg, server string) ([]dns.RR, error) {
+	zone := m.Question[0].Name
+
+	if err := tr.WriteMsg(m); err != nil {
 		return nil, err
 	}
 
+	timeout := tr.ReadTimeout
+	if timeout <= 0 {
+		timeout = DEF_READ_TIMEOUT
+	}
+
 	var res []dns.RR
-	for ex := range a {
-		if ex.Error != nil {
-			return nil, ex.Error
+	var serial uint32
+	var count int
+	full := true
+
+	for {
+		tr.SetReadDeadline(time.Now().Add(timeout))
+		in, err := tr.ReadMsg()
+		if err != nil {
+			return nil, err
+		}
+		if in.Id != m.Id {
+			return nil, dns.ErrId
+		}
+		if err := checkResponse("transfer", server, zone, "", in, nil); err != nil {
+			return nil, err
+		}
+
+		if res == nil {
+			if !(len(in.Answer) > 0) {
+				return nil, dns.ErrSoa
+			}
+			soa, ok := in.Answer[0].(*dns.SOA)
+			if !ok {
+				return nil, dns.ErrSoa
+			}
+			serial = soa.Serial
+
+			// an incremental request that is already up to date
+			if m.Question[0].Qtype == dns.TypeIXFR && m.Ns[0].(*dns.SOA).Serial >= serial {
+				return in.Answer, nil
+			}
+		}
+
+		for _, rr := range in.Answer {
+			if soa, ok := rr.(*dns.SOA); ok {
+				switch {
+				case soa.Serial == serial:
+					count++
+				default:
+					full = false
+				}
+			}
+		}
+		res = append(res, in.Answer...)
+
+		// a full transfer has two current SOA records, an incremental one three
+		if (full && count > 1) || count > 2 {
+			return res, nil
 		}
-		res = append(res, ex.RR...)
 	}
+}
+
+func (s *Service) Transfer(zone string) ([]dns.RR, error) {
+	return s.TransferContext(context.Background(), zone)
+}
 
-	return res, nil
+func (s *Service) TransferContext(ctx context.Context, zone string) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetAxfr(zone)
+
+	return s.transfer(ctx, m)
 }
 
 func (s *Service) Lookup(name string, record uint16) ([]dns.RR, error) {
+	return s.LookupContext(context.Background(), name, record)
+}
+
+func (s *Service) LookupContext(ctx context.Context, name string, record uint16) ([]dns.RR, error) {
 	m := new(dns.Msg)
 	m.SetQuestion(dns.Fqdn(name), record)
 	m.RecursionDesired = true
 
-	h, err := s.ServerPort()
+	h, err := s.ServerPortContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	c := new(dns.Client)
-	r, _, err := c.Exchange(m, h)
-	if err != nil {
+	r, err := exchange(ctx, s.client(), m, h)
+	if err := checkResponse("lookup", h, "", dns.Fqdn(name), r, err); err != nil {
 		return nil, err
 	}
 
-	if r.Rcode != dns.RcodeSuccess {
-		return nil, errors.New(fmt.Sprintf("invalid lookup answer for %s", name))
-	}
-
 	return r.Answer, nil
 }
 
@@ -106,6 +258,8 @@ func (s *Service) Decode(records []dns.RR) *Device {
 		switch x := r.(type) {
 		case *dns.A:
 			d.IP = CopyIP(x.A)
+		case *dns.AAAA:
+			d.IP6 = CopyIP(x.AAAA)
 		case *dns.CNAME:
 		case *dns.TXT:
 			d.Place = strings.Join(x.Txt, " ")
@@ -121,76 +275,122 @@ func (s *Service) Decode(records []dns.RR) *Device {
 }
 
 func (s *Service) Find(name string) (*Device, error) {
-	var res []dns.RR
+	return s.FindContext(context.Background(), name)
+}
 
-	// search for an A record
-	ans, err := s.Lookup(name, dns.TypeA)
-	if err != nil {
-		return nil, err
+func (s *Service) FindContext(ctx context.Context, name string) (*Device, error) {
+
+	// run the record lookups concurrently
+	types := []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeTXT, dns.TypeHINFO, dns.TypeLOC}
+
+	answers := make([][]dns.RR, len(types))
+	errs := make([]error, len(types))
+
+	var wg sync.WaitGroup
+	for i, t := range types {
+		wg.Add(1)
+		go func(i int, t uint16) {
+			defer wg.Done()
+			answers[i], errs[i] = s.LookupContext(ctx, name, t)
+		}(i, t)
 	}
-	// we need at least one
-	if !(len(ans) > 0) {
-		return nil, nil
+	wg.Wait()
+
+	// the A record search must succeed
+	if errs[0] != nil {
+		return nil, errs[0]
 	}
-	res = append(res, ans...)
 
 	// gather other records ...
-	txt, err := s.Lookup(name, dns.TypeTXT)
-	if err == nil {
-		res = append(res, txt...)
-	}
-	hinfo, err := s.Lookup(name, dns.TypeHINFO)
-	if err == nil {
-		res = append(res, hinfo...)
+	var res []dns.RR
+	for i := range types {
+		if errs[i] == nil {
+			res = append(res, answers[i]...)
+		}
 	}
-	loc, err := s.Lookup(name, dns.TypeLOC)
-	if err == nil {
-		res = append(res, loc...)
+
+	// we need at least one address
+	if !(len(answers[0]) > 0) && !(len(answers[1]) > 0) {
+		return nil, nil
 	}
 
 	return s.Decode(res), nil
 }
 
+// FindMany looks up a set of devices concurrently, returning the devices and any lookup
+// errors in the same order as the given names. Missing devices are returned as nil.
+func (s *Service) FindMany(names []string) ([]*Device, []error) {
+	return s.FindManyContext(context.Background(), names)
+}
+
+func (s *Service) FindManyContext(ctx context.Context, names []string) ([]*Device, []error) {
+	devices := make([]*Device, len(names))
+	errs := make([]error, len(names))
+
+	workers := s.Workers
+	if workers <= 0 {
+		workers = DEF_WORKERS
+	}
+
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(names); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				devices[i], errs[i] = s.FindContext(ctx, names[i])
+			}
+		}()
+	}
+
+	for i := range names {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	return devices, errs
+}
+
 func (s *Service) FindByIP(ip net.IP) (*Device, error) {
-	h, err := net.LookupAddr(ip.String())
+	return s.FindByIPContext(context.Background(), ip)
+}
+
+func (s *Service) FindByIPContext(ctx context.Context, ip net.IP) (*Device, error) {
+	h, err := s.resolver().LookupAddr(ctx, ip.String())
 	if err != nil {
 		return nil, err
 	}
 	if !(len(h) > 0) {
 		return nil, nil
 	}
-	return s.Find(h[0])
+	return s.FindContext(ctx, h[0])
 }
 
 func (s *Service) List(zones, reverse []string) ([]*Device, error) {
-	devices := make(map[string]Device)
+	return s.ListContext(context.Background(), zones, reverse)
+}
+
+func (s *Service) ListContext(ctx context.Context, zones, reverse []string) ([]*Device, error) {
 
 	// reverse lookups ....
-	ptrs := make(map[string]string)
+	var ptrs []dns.RR
 	for _, z := range reverse {
-		rr, err := s.Transfer(z)
+		rr, err := s.TransferContext(ctx, z)
 		if err != nil {
 			return nil, err
 		}
-		// only collect PTR record details ...
-		for _, r := range rr {
-			switch x := r.(type) {
-			case *dns.PTR:
-				s := strings.Split(strings.Replace(x.Header().Name, z, "", -1)+
-					strings.Replace(z, ".in-addr.arpa.", "", -1), ".")
-				for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
-					s[i], s[j] = s[j], s[i]
-				}
-				ptrs[strings.Join(s, ".")] = x.Ptr
-			}
-		}
+		ptrs = append(ptrs, rr...)
 	}
 
 	// recover dns entries
 	var rr []dns.RR
 	for _, z := range zones {
 
-		r, err := s.Transfer(z)
+		r, err := s.TransferContext(ctx, z)
 		if err != nil {
 			return nil, err
 		}
@@ -198,12 +398,36 @@ func (s *Service) List(zones, reverse []string) ([]*Device, error) {
 
 	}
 
-	// search for A and CNAME records
+	return assemble(rr, ptrs), nil
+}
+
+// build the devices described by a set of forward and reverse zone records
+func assemble(rr, reverse []dns.RR) []*Device {
+	devices := make(map[string]Device)
+
+	// only collect PTR record details ...
+	ptrs := make(map[string]string)
+	for _, r := range reverse {
+		switch x := r.(type) {
+		case *dns.PTR:
+			if ip := reverseIP(x.Header().Name); ip != nil {
+				ptrs[ip.String()] = x.Ptr
+			}
+		}
+	}
+
+	// search for A, AAAA and CNAME records
 	cnames := make(map[string]string)
 	for _, r := range rr {
 		switch x := r.(type) {
 		case *dns.A:
-			devices[r.Header().Name] = Device{Name: r.Header().Name, IP: CopyIP(x.A)}
+			d := devices[r.Header().Name]
+			d.Name, d.IP = r.Header().Name, CopyIP(x.A)
+			devices[r.Header().Name] = d
+		case *dns.AAAA:
+			d := devices[r.Header().Name]
+			d.Name, d.IP6 = r.Header().Name, CopyIP(x.AAAA)
+			devices[r.Header().Name] = d
 		case *dns.PTR:
 		case *dns.CNAME:
 			//cnames[x.Target] = append(cnames[x.Target], r.Header().Name)
@@ -261,6 +485,7 @@ func (s *Service) List(zones, reverse []string) ([]*Device, error) {
 		}
 		switch x := r.(type) {
 		case *dns.A:
+		case *dns.AAAA:
 		case *dns.PTR:
 		case *dns.CNAME:
 		case *dns.TXT:
@@ -285,10 +510,14 @@ func (s *Service) List(zones, reverse []string) ([]*Device, error) {
 	res := make([]*Device, 0, len(devices))
 	for _, k := range keys {
 		d := devices[k]
+		sort.Strings(d.Aliases)
+		sort.Slice(d.Reverse, func(i, j int) bool {
+			return bytes.Compare(d.Reverse[i].To16(), d.Reverse[j].To16()) < 0
+		})
 		res = append(res, &d)
 	}
 
-	return res, nil
+	return res
 }
 
 // see RFC1876 - A Means for Expressing Location Information in the Domain Name System
@@ -312,6 +541,28 @@ func (d *Device) ToOPT() *dns.OPT {
 	return rr
 }
 
+// build an address DNS RR
+func (d *Device) ToA() *dns.A {
+
+	rr := &dns.A{
+		Hdr: dns.RR_Header{Name: dns.Fqdn(d.Name), Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 0},
+		A:   d.IP,
+	}
+
+	return rr
+}
+
+// build an ipv6 address DNS RR
+func (d *Device) ToAAAA() *dns.AAAA {
+
+	rr := &dns.AAAA{
+		Hdr:  dns.RR_Header{Name: dns.Fqdn(d.Name), Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 0},
+		AAAA: d.IP6,
+	}
+
+	return rr
+}
+
 // build a model/code DNS RR
 func (d *Device) ToHINFO() *dns.HINFO {
 
@@ -354,6 +605,10 @@ func (d *Device) ToTXT() *dns.TXT {
 
 // dynamically update the device info stored in DNS
 func (s *Service) UpdateInfo(zone string, device *Device) error {
+	return s.UpdateInfoContext(context.Background(), zone, device)
+}
+
+func (s *Service) UpdateInfoContext(ctx context.Context, zone string, device *Device) error {
 
 	rr := []dns.RR{
 		device.ToOPT(),
@@ -362,11 +617,15 @@ func (s *Service) UpdateInfo(zone string, device *Device) error {
 		device.ToLOC(),
 	}
 
-	return s.Insert(zone, rr)
+	return s.apply(ctx, EVENT_INFO, zone, PLAN_INSERT, rr)
 }
 
 // dynamically remove the device info stored in DNS (usually prior to an update)
 func (s *Service) RemoveInfo(zone string, device *Device) error {
+	return s.RemoveInfoContext(context.Background(), zone, device)
+}
+
+func (s *Service) RemoveInfoContext(ctx context.Context, zone string, device *Device) error {
 
 	rr := []dns.RR{
 		device.ToOPT(),
@@ -375,17 +634,73 @@ func (s *Service) RemoveInfo(zone string, device *Device) error {
 		device.ToLOC(),
 	}
 
-	return s.RemoveRRset(zone, rr)
+	return s.apply(ctx, EVENT_INFO, zone, PLAN_REMOVE_RRSET, rr)
+}
+
+// dynamically replace the device info stored in DNS, the old records are removed and the
+// new ones inserted as a single update
+func (s *Service) ReplaceInfo(zone string, device *Device) error {
+	return s.ReplaceInfoContext(context.Background(), zone, device)
+}
+
+func (s *Service) ReplaceInfoContext(ctx context.Context, zone string, device *Device) error {
+	p := Plan{}
+	s.PlanReplaceInfo(&p, zone, device)
+
+	return s.SendContext(ctx, &p)
+}
+
+// PlanReplaceInfo adds the replacement of the device info records to a plan. Only the details the
+// device holds (place, model or code, and location) are replaced, the records of any other given
+// types are removed.
+func (s *Service) PlanReplaceInfo(p *Plan, zone string, device *Device, types ...uint16) {
+
+	given := func(t uint16) bool {
+		for _, x := range types {
+			if x == t {
+				return true
+			}
+		}
+		return false
+	}
+
+	var remove, insert []dns.RR
+	for _, x := range []struct {
+		has bool
+		rr  dns.RR
+	}{
+		{device.Place != "", device.ToTXT()},
+		{device.Model != "" || device.Code != "", device.ToHINFO()},
+		{device.HasLocation(), device.ToLOC()},
+	} {
+		switch {
+		case x.has:
+			remove, insert = append(remove, x.rr), append(insert, x.rr)
+		case given(x.rr.Header().Rrtype):
+			remove = append(remove, x.rr)
+		}
+	}
+
+	if len(remove) > 0 {
+		s.change(p, EVENT_INFO, zone, PLAN_REMOVE_RRSET, remove...)
+	}
+	if len(insert) > 0 {
+		s.change(p, EVENT_INFO, zone, PLAN_INSERT, insert...)
+	}
 }
 
 // remove all RR values stored in DNS
 func (s *Service) RemoveAll(zone string, device *Device) error {
+	return s.RemoveAllContext(context.Background(), zone, device)
+}
+
+func (s *Service) RemoveAllContext(ctx context.Context, zone string, device *Device) error {
 
 	rr := &dns.ANY{
 		Hdr: dns.RR_Header{Name: dns.Fqdn(device.Name), Rrtype: dns.TypeANY, Class: dns.ClassANY, Ttl: 0},
 	}
 
-	return s.RemoveName(zone, []dns.RR{rr})
+	return s.apply(ctx, EVENT_REMOVE_DEVICE, zone, PLAN_REMOVE_NAME, []dns.RR{rr})
 }
 
 func findPrivateZone(ip net.IP, zone string) string {
@@ -398,96 +713,182 @@ func findPrivateZone(ip net.IP, zone string) string {
 		z = "16.172.in-addr.arpa."
 	case strings.HasPrefix(ip.String(), "192.168."):
 		z = "168.192.in-addr.arpa."
+	case ip.To4() == nil && len(ip) == net.IPv6len && ip[0]&0xfe == 0xfc:
+		// unique local addresses, fc00::/7
+		z = fmt.Sprintf("%x.%x.ip6.arpa.", ip[0]&0x0f, ip[0]>>4)
 	}
 
 	return z
 }
 
-// Dynamically add a set of RR records stored in DNS
-func (s *Service) Insert(zone string, rr []dns.RR) error {
-	m := new(dns.Msg)
+// FindZone returns the name of the zone holding the given name, as given by the SOA
+// record found in either the answer or authority section of the response.
+func (s *Service) FindZone(name string) (string, error) {
+	return s.FindZoneContext(context.Background(), name)
+}
 
-	m.SetUpdate(zone)
-	m.SetTsig(dns.Fqdn(s.Key), dns.HmacMD5, 300, time.Now().Unix())
-	m.Insert(rr)
+func (s *Service) FindZoneContext(ctx context.Context, name string) (string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), dns.TypeSOA)
+	m.RecursionDesired = true
 
-	h, err := s.ServerPort()
+	h, err := s.ServerPortContext(ctx)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	c := new(dns.Client)
-	c.TsigSecret = map[string]string{dns.Fqdn(s.Key): s.Secret}
+	// a missing name still has the zone SOA in the authority section
+	r, err := exchange(ctx, s.client(), m, h)
+	if err := checkResponse("lookup", h, "", dns.Fqdn(name), r, err); err != nil && !errors.Is(err, ErrNXDomain) {
+		return "", err
+	}
 
-	r, _, err := c.Exchange(m, h)
-	if err != nil {
-		return err
+	for _, rr := range append(r.Answer, r.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Header().Name, nil
+		}
 	}
 
-	if r.Rcode != dns.RcodeSuccess {
-		return errors.New(fmt.Sprintf("invalid exchange answer"))
+	return "", nil
+}
+
+// find the reverse zone for an address, private IPv4 and unique local IPv6 addresses
+// use their well known zones, other IPv6 addresses are found via an SOA lookup.
+func (s *Service) reverseZone(ctx context.Context, ip net.IP, zone string) (string, error) {
+	if z := findPrivateZone(ip, zone); z != zone || ip.To4() != nil {
+		return z, nil
 	}
 
-	return nil
+	z, err := s.FindZoneContext(ctx, reverseAddress(ip))
+	if err != nil {
+		return "", err
+	}
+	if z == "" || !dns.IsSubDomain("ip6.arpa.", z) {
+		return zone, nil
+	}
+
+	return z, nil
 }
 
-// Dynamically remove a set of RR records stored in DNS
-func (s *Service) RemoveRRset(zone string, rr []dns.RR) error {
-	m := new(dns.Msg)
+// the TSIG algorithm to use for updates
+func (s *Service) algorithm() string {
+	if s.Algorithm == "" {
+		return dns.HmacMD5
+	}
+	if a, err := Algorithm(s.Algorithm); err == nil {
+		return a
+	}
+	return s.Algorithm
+}
 
-	m.SetUpdate(zone)
-	m.SetTsig(dns.Fqdn(s.Key), dns.HmacMD5, 300, time.Now().Unix())
-	m.RemoveRRset(rr)
+// sign and send a dynamic update message
+func (s *Service) update(ctx context.Context, m *dns.Msg) error {
+	m.SetTsig(dns.Fqdn(s.Key), s.algorithm(), 300, time.Now().Unix())
 
-	h, err := s.ServerPort()
+	h, err := s.ServerPortContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	c := new(dns.Client)
+	c := s.client()
 	c.TsigSecret = map[string]string{dns.Fqdn(s.Key): s.Secret}
+	if m.Len() > dns.MinMsgSize {
+		c.Net = "tcp"
+	}
 
-	r, _, err := c.Exchange(m, h)
-	if err != nil {
-		return err
+	var zone string
+	if len(m.Question) > 0 {
+		zone = m.Question[0].Name
+	}
+
+	r, err := exchange(ctx, c, m, h)
+
+	return checkResponse("update", h, zone, "", r, err)
+}
+
+// Send the planned changes and prerequisites, each zone is updated via a single message so
+// either all or none of its changes are applied. Zones are updated in the order first planned.
+func (s *Service) Send(p *Plan) error {
+	return s.SendContext(context.Background(), p)
+}
+
+func (s *Service) SendContext(ctx context.Context, p *Plan) error {
+	if s.DryRun != nil {
+		s.DryRun.Steps = append(s.DryRun.Steps, p.Steps...)
+		return nil
 	}
 
-	if r.Rcode != dns.RcodeSuccess {
-		return errors.New(fmt.Sprintf("invalid exchange answer"))
+	for _, m := range p.Messages() {
+		if !(len(m.Ns) > 0) {
+			continue
+		}
+		if err := s.update(ctx, m); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// Dynamically add a set of RR records stored in DNS
+func (s *Service) Insert(zone string, rr []dns.RR) error {
+	return s.InsertContext(context.Background(), zone, rr)
+}
+
+func (s *Service) InsertContext(ctx context.Context, zone string, rr []dns.RR) error {
+	return s.apply(ctx, EVENT_RECORD, zone, PLAN_INSERT, rr)
+}
+
+// Dynamically remove a set of RR records stored in DNS
+func (s *Service) RemoveRRset(zone string, rr []dns.RR) error {
+	return s.RemoveRRsetContext(context.Background(), zone, rr)
+}
+
+func (s *Service) RemoveRRsetContext(ctx context.Context, zone string, rr []dns.RR) error {
+	return s.apply(ctx, EVENT_RECORD, zone, PLAN_REMOVE_RRSET, rr)
+}
+
 // Dynamically remove a full set of RR records stored in DNS
 func (s *Service) RemoveName(zone string, rr []dns.RR) error {
-	m := new(dns.Msg)
-
-	m.SetUpdate(zone)
-	m.SetTsig(dns.Fqdn(s.Key), dns.HmacMD5, 300, time.Now().Unix())
-	m.RemoveName(rr)
+	return s.RemoveNameContext(context.Background(), zone, rr)
+}
 
-	h, err := s.ServerPort()
-	if err != nil {
-		return err
-	}
+func (s *Service) RemoveNameContext(ctx context.Context, zone string, rr []dns.RR) error {
+	return s.apply(ctx, EVENT_RECORD, zone, PLAN_REMOVE_NAME, rr)
+}
 
-	c := new(dns.Client)
-	c.TsigSecret = map[string]string{dns.Fqdn(s.Key): s.Secret}
+// add changes to a plan, reporting each to the logger, all planned updates pass through here
+func (s *Service) change(p *Plan, event, zone, op string, rr ...dns.RR) {
+	p.add(zone, op, rr)
 
-	r, _, err := c.Exchange(m, h)
-	if err != nil {
-		return err
+	if s.Logger == nil {
+		return
 	}
-
-	if r.Rcode != dns.RcodeSuccess {
-		return errors.New(fmt.Sprintf("invalid exchange answer"))
+	for _, r := range rr {
+		if _, ok := r.(*dns.OPT); ok {
+			continue
+		}
+		s.Logger.Log(Event{Type: event, Zone: dns.Fqdn(zone), Op: op, Record: r})
 	}
+}
 
-	return nil
+// plan and send a single set of changes
+func (s *Service) apply(ctx context.Context, event, zone, op string, rr []dns.RR) error {
+	p := Plan{}
+	s.change(&p, event, zone, op, rr...)
+
+	return s.SendContext(ctx, &p)
 }
 
 func reverseAddress(ip net.IP) string {
+	if ip.To4() == nil && len(ip) == net.IPv6len {
+		// nibble format, RFC 3596
+		var n []string
+		for i := len(ip) - 1; i >= 0; i-- {
+			n = append(n, fmt.Sprintf("%x.%x", ip[i]&0x0f, ip[i]>>4))
+		}
+		return strings.Join(n, ".") + ".ip6.arpa."
+	}
 	d := strings.Split(ip.String(), ".")
 	for i, j := 0, len(d)-1; i < j; i, j = i+1, j-1 {
 		d[i], d[j] = d[j], d[i]
@@ -495,142 +896,200 @@ func reverseAddress(ip net.IP) string {
 	return strings.Join(d, ".") + ".in-addr.arpa."
 }
 
+// recover the address from a reverse lookup name, either in-addr.arpa. or ip6.arpa.
+func reverseIP(name string) net.IP {
+	l := dns.SplitDomainName(strings.ToLower(name))
+
+	switch {
+	case len(l) == 6 && l[4] == "in-addr" && l[5] == "arpa":
+		return net.ParseIP(strings.Join([]string{l[3], l[2], l[1], l[0]}, "."))
+	case len(l) == 34 && l[32] == "ip6" && l[33] == "arpa":
+		var b []byte
+		for i := 31; i >= 0; i-- {
+			if len(l[i]) != 1 {
+				return nil
+			}
+			b = append(b, l[i][0])
+			if i%4 == 0 && i > 0 {
+				b = append(b, ':')
+			}
+		}
+		return net.ParseIP(string(b))
+	}
+
+	return nil
+}
+
 func (s *Service) UpdateReverse(zone string, ttl uint32, from, to *Device) error {
+	return s.UpdateReverseContext(context.Background(), zone, ttl, from, to)
+}
+
+func (s *Service) UpdateReverseContext(ctx context.Context, zone string, ttl uint32, from, to *Device) error {
+	p := Plan{}
+	if err := s.planUpdateReverse(ctx, &p, zone, ttl, from, to); err != nil {
+		return err
+	}
+	return s.SendContext(ctx, &p)
+}
+
+func (s *Service) planUpdateReverse(ctx context.Context, p *Plan, zone string, ttl uint32, from, to *Device) error {
 	for _, r := range from.Reverse {
 		if to.HasReverse(r) {
 			continue
 		}
-		z := findPrivateZone(r, zone)
+		z, err := s.reverseZone(ctx, r, zone)
+		if err != nil {
+			return err
+		}
 		if z == zone {
 			continue
 		}
 
-		fmt.Printf("EXTRA REVERSE: %s\n", r.String())
 		ptr := &dns.PTR{
 			Hdr: dns.RR_Header{Name: reverseAddress(r), Rrtype: dns.TypePTR, Class: dns.ClassINET},
 			Ptr: dns.Fqdn(from.Name),
 		}
-		if err := s.RemoveRRset(z, []dns.RR{ptr}); err != nil {
-			return err
-		}
+		s.change(p, EVENT_EXTRA_REVERSE, z, PLAN_REMOVE_RRSET, ptr)
 	}
 
 	for _, r := range to.Reverse {
 		if from.HasReverse(r) {
 			continue
 		}
-		z := findPrivateZone(r, zone)
+		z, err := s.reverseZone(ctx, r, zone)
+		if err != nil {
+			return err
+		}
 		if z == zone {
 			continue
 		}
-		fmt.Printf("MISSING REVERSE: %s\n", r.String())
 		ptr := &dns.PTR{
 			Hdr: dns.RR_Header{Name: reverseAddress(r), Rrtype: dns.TypePTR, Class: dns.ClassINET},
 		}
-		if err := s.RemoveRRset(z, []dns.RR{ptr}); err != nil {
-			return err
-		}
+		s.change(p, EVENT_MISSING_REVERSE, z, PLAN_REMOVE_RRSET, ptr)
 		ptr = &dns.PTR{
 			Hdr: dns.RR_Header{Name: reverseAddress(r), Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: ttl},
 			Ptr: dns.Fqdn(to.Name),
 		}
-		fmt.Println(ptr)
-		if err := s.Insert(z, []dns.RR{ptr}); err != nil {
-			return err
-		}
+		s.change(p, EVENT_MISSING_REVERSE, z, PLAN_INSERT, ptr)
 	}
 	return nil
 }
 
 func (s *Service) UpdateAlias(zone string, ttl uint32, from, to *Device) error {
+	return s.UpdateAliasContext(context.Background(), zone, ttl, from, to)
+}
+
+func (s *Service) UpdateAliasContext(ctx context.Context, zone string, ttl uint32, from, to *Device) error {
+	p := Plan{}
+	if err := s.planUpdateAlias(ctx, &p, zone, ttl, from, to); err != nil {
+		return err
+	}
+	return s.SendContext(ctx, &p)
+}
+
+func (s *Service) planUpdateAlias(ctx context.Context, p *Plan, zone string, ttl uint32, from, to *Device) error {
 	for _, r := range from.Aliases {
 		if to.HasAlias(r) {
 			continue
 		}
-		fmt.Printf("EXTRA ALIAS: %s\n", r)
 		cname := &dns.CNAME{
 			Hdr:    dns.RR_Header{Name: dns.Fqdn(r), Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
 			Target: dns.Fqdn(to.Name),
 		}
-		fmt.Println(cname)
-		if err := s.RemoveRRset(zone, []dns.RR{cname}); err != nil {
-			return err
-		}
+		s.change(p, EVENT_EXTRA_ALIAS, zone, PLAN_REMOVE_RRSET, cname)
 	}
 
 	for _, r := range to.Aliases {
 		if from.HasAlias(r) {
 			continue
 		}
-		fmt.Printf("MISSING ALIAS: %s\n", r)
 		cname := &dns.CNAME{
 			Hdr:    dns.RR_Header{Name: dns.Fqdn(r), Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
 			Target: dns.Fqdn(from.Name),
 		}
-		fmt.Println(cname)
-		if err := s.RemoveRRset(zone, []dns.RR{cname}); err != nil {
-			return err
-		}
-		if err := s.Insert(zone, []dns.RR{cname}); err != nil {
-			return err
-		}
+		s.change(p, EVENT_MISSING_ALIAS, zone, PLAN_REMOVE_RRSET, cname)
+		s.change(p, EVENT_MISSING_ALIAS, zone, PLAN_INSERT, cname)
 	}
 	return nil
 }
 
 func (s *Service) UpdateMapping(zone string, ttl uint32, from, to *Device) error {
+	return s.UpdateMappingContext(context.Background(), zone, ttl, from, to)
+}
+
+func (s *Service) UpdateMappingContext(ctx context.Context, zone string, ttl uint32, from, to *Device) error {
+	p := Plan{}
+	if err := s.planUpdateMapping(ctx, &p, zone, ttl, from, to); err != nil {
+		return err
+	}
+	return s.SendContext(ctx, &p)
+}
+
+func (s *Service) planUpdateMapping(ctx context.Context, p *Plan, zone string, ttl uint32, from, to *Device) error {
 	for m, i := range from.Mapping {
 		if to.HasMapping(m, i) {
 			continue
 		}
-		fmt.Printf("EXTRA MAPPING: %s -> %s\n", m, i.String())
 		ptr := &dns.PTR{
 			Hdr: dns.RR_Header{Name: reverseAddress(i), Rrtype: dns.TypePTR, Class: dns.ClassINET},
 			Ptr: dns.Fqdn(m),
 		}
-		fmt.Println(ptr)
-		z := findPrivateZone(i, zone)
+		z, err := s.reverseZone(ctx, i, zone)
+		if err != nil {
+			return err
+		}
 		if z == zone {
 			continue
 		}
-		if err := s.RemoveRRset(z, []dns.RR{ptr}); err != nil {
-			return err
-		}
+		s.change(p, EVENT_EXTRA_MAPPING, z, PLAN_REMOVE_RRSET, ptr)
 	}
 
 	for m, i := range to.Mapping {
 		if from.HasMapping(m, i) {
 			continue
 		}
-		fmt.Printf("MISSING MAPPING: %s -> %s\n", m, i.String())
 		ptr := &dns.PTR{
 			Hdr: dns.RR_Header{Name: reverseAddress(i), Rrtype: dns.TypePTR, Class: dns.ClassINET},
 			Ptr: dns.Fqdn(m),
 		}
-		fmt.Println(ptr)
-		z := findPrivateZone(i, zone)
-		if z == zone {
-			continue
-		}
-		if err := s.RemoveRRset(z, []dns.RR{ptr}); err != nil {
+		z, err := s.reverseZone(ctx, i, zone)
+		if err != nil {
 			return err
 		}
-		if err := s.Insert(z, []dns.RR{ptr}); err != nil {
-			return err
+		if z == zone {
+			continue
 		}
+		s.change(p, EVENT_MISSING_MAPPING, z, PLAN_REMOVE_RRSET, ptr)
+		s.change(p, EVENT_MISSING_MAPPING, z, PLAN_INSERT, ptr)
 	}
 
 	return nil
 }
 
 func (s *Service) Update(zone string, ttl uint32, from, to *Device) error {
-	if err := s.UpdateReverse(zone, ttl, from, to); err != nil {
+	return s.UpdateContext(context.Background(), zone, ttl, from, to)
+}
+
+// UpdateContext sends the reverse, alias and mapping changes as a single message per zone.
+func (s *Service) UpdateContext(ctx context.Context, zone string, ttl uint32, from, to *Device) error {
+	p := Plan{}
+	if err := s.PlanUpdateContext(ctx, &p, zone, ttl, from, to); err != nil {
+		return err
+	}
+	return s.SendContext(ctx, &p)
+}
+
+// PlanUpdateContext adds the reverse, alias and mapping changes needed to update a device to a plan,
+// allowing prerequisites to be added before it is sent.
+func (s *Service) PlanUpdateContext(ctx context.Context, p *Plan, zone string, ttl uint32, from, to *Device) error {
+	if err := s.planUpdateReverse(ctx, p, zone, ttl, from, to); err != nil {
 		return err
 	}
-	if err := s.UpdateAlias(zone, ttl, from, to); err != nil {
+	if err := s.planUpdateAlias(ctx, p, zone, ttl, from, to); err != nil {
 		return err
 	}
-	if err := s.UpdateMapping(zone, ttl, from, to); err != nil {
+	if err := s.planUpdateMapping(ctx, p, zone, ttl, from, to); err != nil {
 		return err
 	}
 	return nil
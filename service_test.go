@@ -1,7 +1,17 @@
 package zone
 
 import (
+	"context"
+	"errors"
+	"github.com/miekg/dns"
+	"github.com/ozym/place/internal/dnstest"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestToOPT(t *testing.T) {
@@ -39,3 +49,433 @@ func TestToTXT(t *testing.T) {
 		t.Error("ToTXT")
 	}
 }
+
+func TestReverseAddress(t *testing.T) {
+
+	for a, r := range map[string]string{
+		"10.1.2.3":    "3.2.1.10.in-addr.arpa.",
+		"2001:db8::1": "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+	} {
+		ip := net.ParseIP(a)
+		if reverseAddress(ip) != r {
+			t.Errorf("reverseAddress: %s", a)
+		}
+		if !reverseIP(r).Equal(ip) {
+			t.Errorf("reverseIP: %s", r)
+		}
+	}
+}
+
+func TestFindPrivateZone(t *testing.T) {
+
+	if findPrivateZone(net.ParseIP("fd12:3456::1"), "example.com.") != "d.f.ip6.arpa." {
+		t.Error("findPrivateZone")
+	}
+	if findPrivateZone(net.ParseIP("2001:db8::1"), "example.com.") != "example.com." {
+		t.Error("findPrivateZone")
+	}
+}
+
+// a service using an in-process server loaded with the test zones
+func testService(t *testing.T) (*dnstest.Server, *Service) {
+	srv, err := dnstest.NewServer(
+		filepath.Join("testdata", "db.example.com"),
+		filepath.Join("testdata", "10.in-addr.arpa.zone"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	// reverse lookups use the system resolver, so direct it to the test server
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, srv.Addr)
+		},
+	}
+
+	return srv, &Service{Server: srv.Host(), Port: srv.Port(), Key: srv.Key, Secret: srv.Secret, Algorithm: "hmac-sha256", Resolver: resolver}
+}
+
+func TestServiceList(t *testing.T) {
+	_, s := testService(t)
+
+	devices, err := s.List([]string{"example.com."}, []string{"10.in-addr.arpa."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var d *Device
+	for _, x := range devices {
+		if x.Name == "wel-gw.example.com." {
+			d = x
+		}
+	}
+	switch {
+	case d == nil:
+		t.Fatalf("List: missing device %v", devices)
+	case !d.IP.Equal(net.ParseIP("10.1.2.3")) || !d.IP6.Equal(net.ParseIP("2001:db8::3")):
+		t.Errorf("List: addresses %v %v", d.IP, d.IP6)
+	case len(d.Aliases) != 2 || d.Aliases[0] != "wel-map.example.com." || d.Aliases[1] != "wel.example.com.":
+		t.Errorf("List: aliases %v", d.Aliases)
+	case len(d.Reverse) != 1 || !d.Reverse[0].Equal(net.ParseIP("10.1.2.3")):
+		t.Errorf("List: reverse %v", d.Reverse)
+	case d.Model != "Q330" || d.Code != "WEL" || d.Place != "Wellington Office":
+		t.Errorf("List: info %s %s %s", d.Model, d.Code, d.Place)
+	}
+}
+
+func TestServiceFind(t *testing.T) {
+	_, s := testService(t)
+
+	d, err := s.Find("wel-gw.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d == nil || !d.IP.Equal(net.ParseIP("10.1.2.3")) || d.Model != "Q330" || !d.HasLocation() {
+		t.Errorf("Find: %v", d)
+	}
+
+	if _, err := s.Find("missing.example.com"); !errors.Is(err, ErrNXDomain) {
+		t.Errorf("Find: expected %v, found %v", ErrNXDomain, err)
+	}
+
+	d, err = s.FindByIP(net.ParseIP("10.1.2.3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d == nil || d.Name != "wel-gw.example.com." {
+		t.Errorf("FindByIP: %v", d)
+	}
+}
+
+func TestServiceUpdateInfo(t *testing.T) {
+	srv, s := testService(t)
+
+	serial := srv.Serial("example.com.")
+
+	d, err := s.Find("wel-gw.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveInfo("example.com.", d); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Place, d.Model = "Wellington", "Q330HR"
+	if err := s.UpdateInfo("example.com.", d); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = s.Find("wel-gw.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Place != "Wellington" || d.Model != "Q330HR" || d.Code != "WEL" {
+		t.Errorf("UpdateInfo: %s %s %s", d.Place, d.Model, d.Code)
+	}
+	if !(srv.Serial("example.com.") > serial) {
+		t.Errorf("UpdateInfo: serial unchanged")
+	}
+
+	var e *RcodeError
+
+	s.Secret = "d3Jvbmctc2VjcmV0"
+	if err := s.UpdateInfo("example.com.", d); !errors.Is(err, ErrTsig) || !errors.As(err, &e) || e.Rcode != dns.RcodeBadSig {
+		t.Errorf("UpdateInfo: expected a bad signature %v, found %v", ErrTsig, err)
+	}
+
+	s.Key = "other.key."
+	if err := s.UpdateInfo("example.com.", d); !errors.Is(err, ErrTsig) || !errors.As(err, &e) || e.Rcode != dns.RcodeBadKey {
+		t.Errorf("UpdateInfo: expected a bad key %v, found %v", ErrTsig, err)
+	}
+}
+
+func TestServiceUpdate(t *testing.T) {
+	_, s := testService(t)
+
+	from, err := s.Find("wel-gw.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from.Aliases = []string{"wel.example.com.", "wel-map.example.com."}
+	from.Reverse = []net.IP{net.ParseIP("10.1.2.3")}
+
+	to := *from
+	to.Aliases = []string{"wel.example.com.", "wel-new.example.com."}
+	to.Reverse = []net.IP{net.ParseIP("10.1.2.3"), net.ParseIP("10.1.2.5")}
+
+	if err := s.Update("example.com.", 3600, from, &to); err != nil {
+		t.Fatal(err)
+	}
+
+	devices, err := s.List([]string{"example.com."}, []string{"10.in-addr.arpa."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var d *Device
+	for _, x := range devices {
+		if x.Name == "wel-gw.example.com." {
+			d = x
+		}
+	}
+	switch {
+	case d == nil:
+		t.Fatalf("Update: missing device %v", devices)
+	case len(d.Aliases) != 2 || d.Aliases[0] != "wel-new.example.com." || d.Aliases[1] != "wel.example.com.":
+		t.Errorf("Update: aliases %v", d.Aliases)
+	case len(d.Reverse) != 2 || !d.HasReverse(net.ParseIP("10.1.2.5")):
+		t.Errorf("Update: reverse %v", d.Reverse)
+	}
+}
+
+func TestServiceReplaceInfo(t *testing.T) {
+	_, s := testService(t)
+
+	soa, err := s.SOA("example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := s.Find("wel-gw.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Place = "Wellington"
+
+	p := Plan{}
+	p.SerialUnchanged(soa)
+	s.PlanReplaceInfo(&p, "example.com.", d)
+	if m := p.Messages(); len(m) != 1 || len(m[0].Answer) != 1 || len(m[0].Ns) != 6 {
+		t.Fatalf("PlanReplaceInfo: %v", m)
+	}
+	if err := s.Send(&p); err != nil {
+		t.Fatal(err)
+	}
+
+	txt, err := s.Lookup("wel-gw.example.com", dns.TypeTXT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txt) != 1 || strings.Join(txt[0].(*dns.TXT).Txt, " ") != "Wellington" {
+		t.Errorf("ReplaceInfo: %v", txt)
+	}
+
+	// the serial has since changed, so the same prerequisite must now fail
+	d.Place = "Auckland"
+	p = Plan{}
+	p.SerialUnchanged(soa)
+	s.PlanReplaceInfo(&p, "example.com.", d)
+
+	var e *RcodeError
+	if err := s.Send(&p); !errors.As(err, &e) || e.Rcode != dns.RcodeNXRrset || e.Zone != "example.com." {
+		t.Fatalf("ReplaceInfo: expected a stale serial error, found %v", err)
+	}
+	if f, err := s.Find("wel-gw.example.com"); err != nil || f.Place != "Wellington" {
+		t.Errorf("ReplaceInfo: stale update applied %v %v", f, err)
+	}
+}
+
+func TestPlanReplaceInfo(t *testing.T) {
+	s := &Service{}
+
+	// only the details a device holds are replaced, other given types are only removed
+	var tests = []struct {
+		device Device
+		types  []uint16
+		remove []uint16
+		insert []uint16
+	}{
+		{Device{Name: "a.example.com.", Model: "Q330"}, nil, []uint16{dns.TypeHINFO}, []uint16{dns.TypeHINFO}},
+		{Device{Name: "a.example.com.", Place: "Wellington"}, []uint16{dns.TypeLOC}, []uint16{dns.TypeTXT, dns.TypeLOC}, []uint16{dns.TypeTXT}},
+		{Device{Name: "a.example.com.", Latitude: -41.3}, nil, []uint16{dns.TypeLOC}, []uint16{dns.TypeLOC}},
+		{Device{Name: "a.example.com."}, nil, nil, nil},
+	}
+
+	for _, x := range tests {
+		p := Plan{}
+		s.PlanReplaceInfo(&p, "example.com.", &x.device, x.types...)
+
+		found := make(map[string][]uint16)
+		for _, step := range p.ZoneSteps("example.com.") {
+			for _, rr := range step.RR {
+				found[step.Op] = append(found[step.Op], rr.Header().Rrtype)
+			}
+		}
+		for op, expected := range map[string][]uint16{PLAN_REMOVE_RRSET: x.remove, PLAN_INSERT: x.insert} {
+			if len(found[op]) != len(expected) {
+				t.Errorf("PlanReplaceInfo %v: %s %v", x.device, op, found[op])
+				continue
+			}
+			for i := range expected {
+				if found[op][i] != expected[i] {
+					t.Errorf("PlanReplaceInfo %v: %s %v", x.device, op, found[op])
+				}
+			}
+		}
+	}
+}
+
+// a name server that accepts queries and connections but never answers
+func testSilent(t *testing.T) *Service {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { c.Close() })
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Service{Server: host, Port: port, ReadTimeout: time.Minute}
+}
+
+func TestServiceContext(t *testing.T) {
+	_, s := testService(t)
+	silent := testSilent(t)
+
+	// an inventory server that never responds
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer h.Close()
+	remote := strings.TrimPrefix(h.URL, "http://")
+
+	cancelled := func() (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		return ctx, cancel
+	}
+	expired := func() (context.Context, context.CancelFunc) {
+		return context.WithTimeout(context.Background(), 50*time.Millisecond)
+	}
+
+	var tests = []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		err  error
+		call func(context.Context) error
+	}{
+		{"Transfer", cancelled, context.Canceled, func(ctx context.Context) error {
+			_, err := s.TransferContext(ctx, "example.com.")
+			return err
+		}},
+		{"Lookup", cancelled, context.Canceled, func(ctx context.Context) error {
+			_, err := s.LookupContext(ctx, "wel-gw.example.com.", dns.TypeA)
+			return err
+		}},
+		{"LoadRemote", cancelled, context.Canceled, func(ctx context.Context) error {
+			_, err := LoadRemoteContext(ctx, remote)
+			return err
+		}},
+		{"Transfer", expired, context.DeadlineExceeded, func(ctx context.Context) error {
+			_, err := silent.TransferContext(ctx, "example.com.")
+			return err
+		}},
+		{"TransferIncremental", expired, context.DeadlineExceeded, func(ctx context.Context) error {
+			_, err := silent.TransferIncrementalContext(ctx, "example.com.", 1)
+			return err
+		}},
+		{"Lookup", expired, context.DeadlineExceeded, func(ctx context.Context) error {
+			_, err := silent.LookupContext(ctx, "wel-gw.example.com.", dns.TypeA)
+			return err
+		}},
+		{"LoadRemote", expired, context.DeadlineExceeded, func(ctx context.Context) error {
+			_, err := LoadRemoteContext(ctx, remote)
+			return err
+		}},
+	}
+
+	for _, x := range tests {
+		ctx, cancel := x.ctx()
+
+		done := make(chan error, 1)
+		go func() { done <- x.call(ctx) }()
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, x.err) {
+				t.Errorf("%s: expected %v, found %v", x.name, x.err, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: not stopped by %v", x.name, x.err)
+		}
+
+		cancel()
+	}
+}
+
+func TestServiceFindMany(t *testing.T) {
+	_, s := testService(t)
+	s.Workers = 3
+
+	// the expected device name for each name, or the expected error
+	var tests = []struct {
+		name   string
+		device string
+		err    error
+	}{
+		{"wel-gw.example.com", "wel-gw.example.com.", nil},
+		{"missing.example.com", "", ErrNXDomain},
+		{"ns.example.com", "ns.example.com.", nil},
+		{"example.com", "", nil},
+		{"example.org", "", ErrRefused},
+	}
+
+	// repeated so the names are spread over the workers
+	var names []string
+	for i := 0; i < 4; i++ {
+		for _, x := range tests {
+			names = append(names, x.name)
+		}
+	}
+
+	devices, errs := s.FindMany(names)
+	if len(devices) != len(names) || len(errs) != len(names) {
+		t.Fatalf("FindMany: expected %d results, found %d %d", len(names), len(devices), len(errs))
+	}
+
+	for i := range names {
+		x := tests[i%len(tests)]
+		switch d, err := devices[i], errs[i]; {
+		case x.err != nil && !errors.Is(err, x.err):
+			t.Errorf("FindMany %d %s: expected %v, found %v", i, x.name, x.err, err)
+		case x.err == nil && err != nil:
+			t.Errorf("FindMany %d %s: %v", i, x.name, err)
+		case x.device == "" && d != nil:
+			t.Errorf("FindMany %d %s: expected no device, found %v", i, x.name, d)
+		case x.device != "" && (d == nil || d.Name != x.device):
+			t.Errorf("FindMany %d %s: expected %s, found %v", i, x.name, x.device, d)
+		}
+	}
+
+	// each device gathers all of its record types
+	d := devices[0]
+	switch {
+	case !d.IP.Equal(net.ParseIP("10.1.2.3")) || !d.IP6.Equal(net.ParseIP("2001:db8::3")):
+		t.Errorf("FindMany: addresses %v %v", d.IP, d.IP6)
+	case d.Place != "Wellington Office" || d.Model != "Q330" || d.Code != "WEL" || !d.HasLocation():
+		t.Errorf("FindMany: info %v", d)
+	}
+}
@@ -0,0 +1,262 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// find a default origin for a zone file from its name, e.g. "db.example.com",
+// "example.com.zone" or "example.com.db" all give "example.com."
+func zoneFileOrigin(path string) string {
+	n := filepath.Base(path)
+	n = strings.TrimPrefix(n, "db.")
+	n = strings.TrimSuffix(n, ".zone")
+	n = strings.TrimSuffix(n, ".db")
+	return dns.Fqdn(n)
+}
+
+// ParseZoneFile reads all records from a master zone file, $ORIGIN, $TTL and $INCLUDE
+// directives are honoured. If no origin is given one is guessed from the file name.
+func ParseZoneFile(path, origin string) ([]dns.RR, error) {
+	if origin == "" {
+		origin = zoneFileOrigin(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zp := dns.NewZoneParser(f, dns.Fqdn(origin), path)
+	zp.SetIncludeAllowed(true)
+
+	var res []dns.RR
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		res = append(res, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// split a zone file entry given as either "path" or "origin=path"
+func zoneFileSpec(spec string) (string, string) {
+	if i := strings.Index(spec, "="); i > 0 && !strings.ContainsAny(spec[:i], `/\`) {
+		return spec[i+1:], spec[:i]
+	}
+	return spec, ""
+}
+
+// LoadZoneFiles builds the devices described in a set of forward and reverse master zone files,
+// as would be found via LoadLocal, but without the need for a DNS server. Each file can be given
+// as "origin=path" (e.g. "10.in-addr.arpa.=db.10"), otherwise its origin is guessed from the file
+// name. A reverse zone file without any usable PTR records is reported as an error, this usually
+// indicates a wrong origin.
+func LoadZoneFiles(forward, reverse []string) (*Devices, error) {
+
+	var ptrs []dns.RR
+	for _, f := range reverse {
+		path, origin := zoneFileSpec(f)
+		rr, err := ParseZoneFile(path, origin)
+		if err != nil {
+			return nil, err
+		}
+
+		var n int
+		for _, r := range rr {
+			if _, ok := r.(*dns.PTR); ok && reverseIP(r.Header().Name) != nil {
+				n++
+			}
+		}
+		if !(n > 0) {
+			return nil, errors.New(fmt.Sprintf("no usable reverse records found in %s, check the zone origin", path))
+		}
+
+		ptrs = append(ptrs, rr...)
+	}
+
+	var rr []dns.RR
+	for _, f := range forward {
+		path, origin := zoneFileSpec(f)
+		r, err := ParseZoneFile(path, origin)
+		if err != nil {
+			return nil, err
+		}
+		rr = append(rr, r...)
+	}
+
+	d := Devices{List: assemble(rr, ptrs)}
+
+	return &d, nil
+}
+
+// NewSOA builds a zone SOA record using common refresh, retry, expire and negative caching times.
+func NewSOA(zone, ns, mbox string, serial, ttl uint32) *dns.SOA {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: dns.Fqdn(zone), Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+		Ns:      dns.Fqdn(ns),
+		Mbox:    dns.Fqdn(mbox),
+		Serial:  serial,
+		Refresh: 3600,
+		Retry:   900,
+		Expire:  604800,
+		Minttl:  300,
+	}
+}
+
+// NextSerial returns the next zone serial number using the YYYYMMDDnn convention.
+func NextSerial(serial uint32, now time.Time) uint32 {
+	y, m, d := now.UTC().Date()
+	if s := uint32(y*1000000 + int(m)*10000 + d*100); s > serial {
+		return s
+	}
+	return serial + 1
+}
+
+// ForwardRecords builds the A, AAAA, CNAME, TXT, HINFO and LOC records of all devices within the given zone.
+func (d *Devices) ForwardRecords(zone string, ttl uint32) []dns.RR {
+	var res []dns.RR
+
+	add := func(rr dns.RR) {
+		rr.Header().Ttl = ttl
+		res = append(res, rr)
+	}
+
+	for _, s := range d.List {
+		if !dns.IsSubDomain(dns.Fqdn(zone), dns.Fqdn(s.Name)) {
+			continue
+		}
+		if s.IP != nil {
+			add(s.ToA())
+		}
+		if s.IP6 != nil {
+			add(s.ToAAAA())
+		}
+		if s.Place != "" {
+			add(s.ToTXT())
+		}
+		if s.Model != "" || s.Code != "" {
+			add(s.ToHINFO())
+		}
+		if s.HasLocation() {
+			add(s.ToLOC())
+		}
+
+		aliases := append([]string{}, s.Aliases...)
+		for m := range s.Mapping {
+			if !s.HasAlias(m) {
+				aliases = append(aliases, m)
+			}
+		}
+		sort.Strings(aliases)
+
+		for _, a := range aliases {
+			add(&dns.CNAME{
+				Hdr:    dns.RR_Header{Name: dns.Fqdn(a), Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+				Target: dns.Fqdn(s.Name),
+			})
+		}
+	}
+
+	return res
+}
+
+// ReverseRecords builds the PTR records of all device reverse and mapping entries, indexed by
+// the closest matching reverse zone, entries not found in any of the given zones are skipped.
+func (d *Devices) ReverseRecords(zones []string, ttl uint32) map[string][]dns.RR {
+	res := make(map[string][]dns.RR)
+
+	add := func(ip net.IP, name string) {
+		ptr := reverseAddress(ip)
+
+		var zone string
+		for _, z := range zones {
+			if dns.IsSubDomain(dns.Fqdn(z), ptr) && len(dns.Fqdn(z)) > len(zone) {
+				zone = dns.Fqdn(z)
+			}
+		}
+		if zone == "" {
+			return
+		}
+
+		res[zone] = append(res[zone], &dns.PTR{
+			Hdr: dns.RR_Header{Name: ptr, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: ttl},
+			Ptr: dns.Fqdn(name),
+		})
+	}
+
+	for _, s := range d.List {
+		for _, r := range s.Reverse {
+			add(r, s.Name)
+		}
+
+		var keys []string
+		for m := range s.Mapping {
+			keys = append(keys, m)
+		}
+		sort.Strings(keys)
+
+		for _, m := range keys {
+			add(s.Mapping[m], m)
+		}
+	}
+
+	for _, rr := range res {
+		sort.SliceStable(rr, func(i, j int) bool {
+			return rr[i].Header().Name < rr[j].Header().Name
+		})
+	}
+
+	return res
+}
+
+// WriteZone writes a master zone file consisting of the SOA, name servers and the given records.
+func WriteZone(w io.Writer, soa *dns.SOA, ns []string, rr []dns.RR) error {
+	if _, err := fmt.Fprintf(w, "$ORIGIN %s\n$TTL %d\n", soa.Header().Name, soa.Header().Ttl); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, soa.String()); err != nil {
+		return err
+	}
+	for _, n := range ns {
+		r := &dns.NS{
+			Hdr: dns.RR_Header{Name: soa.Header().Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: soa.Header().Ttl},
+			Ns:  dns.Fqdn(n),
+		}
+		if _, err := fmt.Fprintln(w, r.String()); err != nil {
+			return err
+		}
+	}
+	for _, r := range rr {
+		if _, err := fmt.Fprintln(w, r.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteZoneFile writes a master zone file, see WriteZone.
+func WriteZoneFile(path string, soa *dns.SOA, ns []string, rr []dns.RR) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteZone(f, soa, ns, rr); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,116 @@
+package zone
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadZoneFiles(t *testing.T) {
+
+	d, err := LoadZoneFiles([]string{"testdata/db.example.com"}, []string{"testdata/10.in-addr.arpa.zone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.List) != 2 {
+		t.Fatalf("LoadZoneFiles: expected 2 devices, found %d", len(d.List))
+	}
+
+	g := d.Find("wel-gw.example.com.")
+	if g == nil {
+		t.Fatal("LoadZoneFiles: missing device")
+	}
+	if !g.IP.Equal(net.ParseIP("10.1.2.3")) || !g.IP6.Equal(net.ParseIP("2001:db8::3")) {
+		t.Error("LoadZoneFiles: addresses")
+	}
+	if g.Place != "Wellington Office" || g.Model != "Q330" || g.Code != "WEL" || g.Height != 21 {
+		t.Error("LoadZoneFiles: details")
+	}
+	if !g.HasReverse(net.ParseIP("10.1.2.3")) {
+		t.Error("LoadZoneFiles: reverse")
+	}
+	if !g.HasMapping("wel-map.example.com.", net.ParseIP("10.1.2.4")) {
+		t.Error("LoadZoneFiles: mapping")
+	}
+	if len(g.Aliases) != 2 {
+		t.Error("LoadZoneFiles: aliases")
+	}
+}
+
+func TestWriteZoneFile(t *testing.T) {
+
+	d, err := LoadZoneFiles([]string{"testdata/db.example.com"}, []string{"testdata/10.in-addr.arpa.zone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	forward := filepath.Join(dir, "db.example.com")
+	if err := WriteZoneFile(forward, NewSOA("example.com", "ns.example.com", "hostmaster.example.com", 1, 3600), []string{"ns.example.com"}, d.ForwardRecords("example.com", 3600)); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := d.ReverseRecords([]string{"10.in-addr.arpa"}, 3600)
+	if len(rr["10.in-addr.arpa."]) != 2 {
+		t.Fatalf("ReverseRecords: expected 2 records, found %d", len(rr["10.in-addr.arpa."]))
+	}
+
+	reverse := filepath.Join(dir, "10.in-addr.arpa.zone")
+	if err := WriteZoneFile(reverse, NewSOA("10.in-addr.arpa", "ns.example.com", "hostmaster.example.com", 1, 3600), []string{"ns.example.com"}, rr["10.in-addr.arpa."]); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := LoadZoneFiles([]string{forward}, []string{reverse})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.List) != len(d.List) {
+		t.Fatalf("WriteZoneFile: expected %d devices, found %d", len(d.List), len(r.List))
+	}
+	for i := range d.List {
+		if d.List[i].String() != r.List[i].String() {
+			t.Errorf("WriteZoneFile: %s != %s", d.List[i], r.List[i])
+		}
+	}
+}
+
+func TestNextSerial(t *testing.T) {
+
+	now := time.Date(2016, 5, 4, 0, 0, 0, 0, time.UTC)
+
+	if NextSerial(1, now) != 2016050400 {
+		t.Error("NextSerial")
+	}
+	if NextSerial(2016050400, now) != 2016050401 {
+		t.Error("NextSerial")
+	}
+}
+
+func TestLoadZoneFilesOrigin(t *testing.T) {
+
+	b, err := os.ReadFile(filepath.Join("testdata", "10.in-addr.arpa.zone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverse := filepath.Join(t.TempDir(), "db.10")
+	if err := os.WriteFile(reverse, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadZoneFiles([]string{"testdata/db.example.com"}, []string{reverse}); err == nil {
+		t.Error("LoadZoneFiles: expected an error for a guessed reverse origin")
+	}
+
+	d, err := LoadZoneFiles([]string{"example.com.=testdata/db.example.com"}, []string{"10.in-addr.arpa.=" + reverse})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := d.Find("wel-gw.example.com.")
+	if g == nil || !g.HasReverse(net.ParseIP("10.1.2.3")) || !g.HasMapping("wel-map.example.com.", net.ParseIP("10.1.2.4")) {
+		t.Errorf("LoadZoneFiles: %v", g)
+	}
+}